@@ -3,6 +3,7 @@ package main
 import (
 	"halves/pkg/auth"
 	"halves/pkg/handler"
+	"halves/pkg/mail"
 	"halves/pkg/model"
 	"log"
 	"net/http"
@@ -49,6 +50,12 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
+	// games got more statuses, replace the old check that only allowed open and closed
+	if db.Migrator().HasConstraint(&model.Game{}, "chk_games_status") {
+		if err := db.Migrator().DropConstraint(&model.Game{}, "chk_games_status"); err != nil {
+			log.Fatal("Failed to migrate games:", err)
+		}
+	}
 	// Add automigrate after DB connection
 	err = db.AutoMigrate(
 		&model.User{},
@@ -56,8 +63,34 @@ func main() {
 		&model.Device{},
 		&model.Game{},
 		&model.Result{},
+		&model.RefreshToken{},
+		&model.RevokedToken{},
+		&model.ActionToken{},
+		&model.RecoveryCode{},
+		&model.LoginThrottle{},
+		&model.AuditLog{},
+		&model.UserIdentity{},
+		&model.OIDCState{},
+		&model.APIKey{},
+		&model.Round{},
+		&model.Tournament{},
+		&model.TournamentPlayer{},
+		&model.RatingChange{},
+		&model.Season{},
+		&model.SeasonStanding{},
 	)
 
+	// games closed before rounds were stored
+	if err := handler.BackfillRounds(db); err != nil {
+		log.Println("Failed to backfill game rounds:", err)
+	}
+
+	// games closed before closed_at was stored: the last round is close enough
+	if err := db.Exec(`UPDATE games SET closed_at = (SELECT MAX(created_at) FROM rounds WHERE rounds.game_id = games.id)
+		WHERE status = 'closed' AND closed_at = 0 AND EXISTS (SELECT 1 FROM rounds WHERE rounds.game_id = games.id)`).Error; err != nil {
+		log.Println("Failed to backfill game close times:", err)
+	}
+
 	// In main.go, replace the device reset code with:
 	if err := db.Exec("UPDATE devices SET status = 'F'").Error; err != nil {
 		log.Println("Failed to reset device statuses:", err)
@@ -70,13 +103,36 @@ func main() {
 	}
 	sqlDB.SetMaxOpenConns(1) // SQLite requires single connection
 
+	// Load JWT signing keys (JWT_SECRET and/or JWT_KEYS_FILE)
+	keyRing, err := auth.LoadKeyRing()
+	if err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+	auth.SetKeyRing(keyRing)
+
 	// Create services
-	authService := auth.NewAuthService(db)
 	wsHub := handler.NewHub()
+	authService := auth.NewAuthService(db, wsHub, mail.NewSenderFromEnv())
+	authService.PromoteAdmins()
 	messageHandler := handler.NewMessageHandler(db, wsHub)
 	userHandler := handler.NewUserHandler(db)
 	gameHandler := handler.NewGameHandler(db, wsHub)
+	authService.SetTournaments(gameHandler)
+	if err := gameHandler.ResumeTimeouts(); err != nil {
+		log.Printf("Failed to schedule game timeouts: %v", err)
+	}
+	if err := gameHandler.EnsureBots(); err != nil {
+		log.Printf("Failed to create bots: %v", err)
+	} else if err := gameHandler.ResumeBots(); err != nil {
+		log.Printf("Failed to resume bots: %v", err)
+	}
+	if err := gameHandler.ResumeTournaments(); err != nil {
+		log.Printf("Failed to finish tournaments: %v", err)
+	}
 	resultHandler := handler.NewReslutHandler(db)
+	if err := resultHandler.ResumeSeasons(); err != nil {
+		log.Printf("Failed to schedule seasons: %v", err)
+	}
 
 	go wsHub.Run()
 
@@ -94,18 +150,45 @@ func main() {
 	// Auth routes
 	r.POST("/register", authService.Register)
 	r.POST("/login", authService.Login)
+	r.POST("/login/2fa", authService.LoginTOTP)
+	r.POST("/login/magic", authService.RequestMagicLink)
+	r.POST("/login/magic/confirm", authService.ConfirmMagicLink)
+	r.POST("/token/refresh", authService.RefreshToken)
+	r.GET("/.well-known/jwks.json", auth.JWKSHandler)
+	r.GET("/oidc/:provider/login", authService.OIDCLogin)
+	r.GET("/oidc/:provider/callback", authService.OIDCCallback)
+	r.POST("/oidc/:provider/callback", authService.OIDCCallback)
 
 	// Message routes
 	authMiddleware := auth.JWTMiddleware()
 	lastSeenMiddleware := auth.LastSeenUpdater()
-	r.POST("/send", authMiddleware, lastSeenMiddleware, messageHandler.SendMessage)
-	r.GET("/ws/:uuid", authMiddleware, lastSeenMiddleware, wsHub.WebSocketHandler)
+	verifiedMiddleware := auth.RequireVerifiedEmail()
+	userOnly := auth.RequireUserToken() // no API keys
+	r.POST("/send", authMiddleware, auth.RequireScope(auth.ScopeMessagesSend), lastSeenMiddleware, verifiedMiddleware, messageHandler.SendMessage)
+	r.GET("/ws/:uuid", authMiddleware, auth.RequireScope(auth.ScopeMessagesRead, auth.ScopeGamesPlay), lastSeenMiddleware, wsHub.WebSocketHandler)
 	// r.GET("/tws/:uuid", wsHub.WebSocketHandler) // Without auth middleware
-	r.GET("/messages", authMiddleware, lastSeenMiddleware, messageHandler.GetMessages)
+	r.GET("/messages", authMiddleware, auth.RequireScope(auth.ScopeMessagesRead), lastSeenMiddleware, messageHandler.GetMessages)
+	r.POST("/verify-email", authService.VerifyEmail)
+	r.POST("/verify-email/resend", authMiddleware, userOnly, authService.ResendVerification)
+	r.POST("/2fa/enroll", authMiddleware, userOnly, authService.EnrollTOTP)
+	r.POST("/2fa/enable", authMiddleware, userOnly, authService.EnableTOTP)
+	r.POST("/2fa/disable", authMiddleware, userOnly, authService.DisableTOTP)
+	r.POST("/logout", authMiddleware, userOnly, authService.Logout)
+	r.POST("/logout/all", authMiddleware, userOnly, authService.LogoutAll)
+	r.GET("/sessions", authMiddleware, userOnly, authService.ListSessions)
+	r.DELETE("/sessions/:deviceID", authMiddleware, userOnly, authService.RevokeSession)
+	r.POST("/api-keys", authMiddleware, userOnly, authService.CreateAPIKey)
+	r.GET("/api-keys", authMiddleware, userOnly, authService.ListAPIKeys)
+	r.DELETE("/api-keys/:id", authMiddleware, userOnly, authService.RevokeAPIKey)
+	r.DELETE("/me", authMiddleware, userOnly, authService.RequestAccountDeletion)
+	r.POST("/me/restore", authMiddleware, userOnly, authService.CancelAccountDeletion)
+	r.GET("/me/export", authMiddleware, userOnly, authService.ExportAccount)
+	r.POST("/me/email", authMiddleware, userOnly, authService.RequestEmailChange)
+	r.POST("/me/email/confirm", authService.ConfirmEmailChange)
 	// Add to routes
 	r.POST("/reset-password", authService.RequestPasswordReset)
 	r.POST("/reset-password/confirm", authService.ResetPassword)
-	r.POST("/update-score", authMiddleware, userHandler.UpdateScore)
+	r.POST("/update-score", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay), userHandler.UpdateScore)
 	r.GET("/health", func(c *gin.Context) {
 		if err := db.Exec("SELECT 1").Error; err != nil {
 			c.Status(http.StatusServiceUnavailable)
@@ -113,11 +196,35 @@ func main() {
 		}
 		c.Status(http.StatusOK)
 	})
-	r.POST("/game/invite", authMiddleware, gameHandler.CreateGame)
-	r.POST("/game/vote", authMiddleware, gameHandler.HandleVote)
-	r.GET("/games/active", authMiddleware, gameHandler.GetActiveGames)
+	r.POST("/game/invite", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay), verifiedMiddleware, gameHandler.CreateGame)
+	r.POST("/game/vote", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay), gameHandler.HandleVote)
+	r.POST("/game/:id/accept", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay), gameHandler.AcceptInvite)
+	r.POST("/game/:id/decline", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay), gameHandler.DeclineInvite)
+	r.POST("/game/:id/cancel", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay), gameHandler.CancelInvite)
+	r.GET("/games/active", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay, auth.ScopeResultsRead), gameHandler.GetActiveGames)
+	r.GET("/games/types", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay, auth.ScopeResultsRead), gameHandler.GetGameTypes)
+	r.GET("/bots", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay, auth.ScopeResultsRead), gameHandler.GetBots)
+	r.GET("/games/history", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay, auth.ScopeResultsRead), gameHandler.GetHistory)
+	r.GET("/users/:id/stats", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay, auth.ScopeResultsRead), gameHandler.GetUserStats)
+	r.GET("/users/:id/rating", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay, auth.ScopeResultsRead), gameHandler.GetRating)
+	r.GET("/game/:id/rounds", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay, auth.ScopeResultsRead), gameHandler.GetRounds)
 	r.GET("/result", resultHandler.GetResult)
-	r.DELETE("/users", userHandler.DeleteUsers)
+	r.GET("/leaderboard", resultHandler.GetLeaderboard)
+	r.GET("/seasons", resultHandler.GetSeasons)
+	r.GET("/seasons/:id", resultHandler.GetSeason)
+
+	// Moderation and admin routes
+	moderatorOnly := auth.RequireRole(model.RoleModerator)
+	adminOnly := auth.RequireRole(model.RoleAdmin)
+	r.DELETE("/messages/:id", authMiddleware, userOnly, moderatorOnly, messageHandler.DeleteMessage)
+	r.POST("/tournaments", authMiddleware, userOnly, moderatorOnly, gameHandler.CreateTournament)
+	r.GET("/tournaments", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay, auth.ScopeResultsRead), gameHandler.GetTournaments)
+	r.GET("/tournaments/:id", authMiddleware, auth.RequireScope(auth.ScopeGamesPlay, auth.ScopeResultsRead), gameHandler.GetTournament)
+	r.PUT("/admin/users/:id/role", authMiddleware, userOnly, adminOnly, authService.SetUserRole)
+	r.DELETE("/admin/users/:id", authMiddleware, userOnly, adminOnly, authService.DeleteUser)
+	r.GET("/admin/audit", authMiddleware, userOnly, adminOnly, authService.ListAuditLogs)
+	r.POST("/admin/seasons", authMiddleware, userOnly, adminOnly, resultHandler.CreateSeason)
+	r.POST("/admin/seasons/:id/end", authMiddleware, userOnly, adminOnly, resultHandler.EndSeason)
 	// Add periodic cleanup task (after route setup)
 	go func() {
 		ticker := time.NewTicker(5 * time.Minute)
@@ -128,6 +235,15 @@ func main() {
 			db.Model(&model.Device{}).
 				Where("last_seen < ? AND status = 'O'", threshold).
 				Update("status", "F")
+			db.Where("expires_at < ?", time.Now().Unix()).
+				Delete(&model.RefreshToken{})
+			db.Where("expires_at < ?", time.Now().Unix()).
+				Delete(&model.ActionToken{})
+			db.Where("expires_at < ?", time.Now().Unix()).
+				Delete(&model.OIDCState{})
+			authService.PruneRevocations()
+			authService.PruneLoginThrottles()
+			authService.PurgeDeletedAccounts()
 		}
 	}()
 
@@ -0,0 +1,380 @@
+package auth
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"halves/pkg/model"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func accountDeletionGrace() time.Duration {
+	return envDuration("ACCOUNT_DELETION_GRACE", 7*24*time.Hour)
+}
+
+// RequestAccountDeletion schedules the current user's account for deletion
+// after the grace period, logs them out everywhere and revokes their API
+// keys. The password (and the second factor, if enabled) must be confirmed.
+func (s *AuthService) RequestAccountDeletion(c *gin.Context) {
+	var req struct {
+		Password     string `json:"password" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.MustGet("userID").(string)
+
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.Password == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "set a password through password reset first"})
+		return
+	}
+
+	deleteAfter := time.Now().Add(accountDeletionGrace())
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if ok, _ := verifyPassword(req.Password, user.Password); !ok {
+			return errSecondFactorInvalid
+		}
+		if user.TOTPEnabled {
+			if err := verifySecondFactor(tx, &user, req.Code, req.RecoveryCode); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&user).Update("delete_after", deleteAfter.Unix()).Error; err != nil {
+			return err
+		}
+		// API keys would keep working through the grace period otherwise
+		return tx.Model(&model.APIKey{}).
+			Where("user_id = ? AND revoked_at = 0", userID).
+			Update("revoked_at", time.Now().Unix()).Error
+	})
+	if errors.Is(err, errSecondFactorInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to schedule deletion"})
+		return
+	}
+
+	if err := s.RevokeUserSessions(userID); err != nil {
+		log.Printf("Failed to revoke sessions before deletion: %v", err)
+	}
+	s.audit(c, userID, auditDeletionRequested, "")
+	s.sendMail(user.Email, "deletion", map[string]string{
+		"DELETE_AFTER": deleteAfter.UTC().Format("2 January 2006 15:04 MST"),
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "account scheduled for deletion", "delete_after": deleteAfter.Unix()})
+}
+
+// CancelAccountDeletion keeps an account that is still in its grace period
+func (s *AuthService) CancelAccountDeletion(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	result := s.db.Model(&model.User{}).
+		Where("id = ? AND delete_after > ?", userID, time.Now().Unix()).
+		Update("delete_after", 0)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel deletion"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no deletion scheduled"})
+		return
+	}
+	s.audit(c, userID, auditDeletionCancelled, "")
+
+	c.JSON(http.StatusOK, gin.H{"status": "deletion cancelled"})
+}
+
+// PurgeDeletedAccounts removes the accounts whose grace period is over
+func (s *AuthService) PurgeDeletedAccounts() {
+	var ids []string
+	if err := s.db.Model(&model.User{}).
+		Where("delete_after > 0 AND delete_after < ?", time.Now().Unix()).
+		Pluck("id", &ids).Error; err != nil {
+		log.Println("Failed to find accounts to delete:", err)
+		return
+	}
+	for _, id := range ids {
+		var tournaments []uint
+		if err := s.db.Transaction(func(tx *gorm.DB) (err error) {
+			tournaments, err = purgeUser(tx, id)
+			return err
+		}); err != nil {
+			log.Printf("Failed to delete account %s: %v", id, err)
+			continue
+		}
+		if s.sessions != nil {
+			s.sessions.DisconnectUser(id)
+		}
+		s.finishTournaments(tournaments)
+		log.Printf("Deleted account %s", id)
+	}
+}
+
+// TournamentFinisher finishes tournaments that have no games left to play
+type TournamentFinisher interface {
+	FinishTournaments(ids []uint)
+}
+
+// SetTournaments lets deleting a participant finish their tournaments
+func (s *AuthService) SetTournaments(t TournamentFinisher) {
+	s.tournaments = t
+}
+
+// finishTournaments finishes the tournaments whose remaining games were
+// cancelled with a user
+func (s *AuthService) finishTournaments(ids []uint) {
+	if s.tournaments != nil && len(ids) > 0 {
+		s.tournaments.FinishTournaments(ids)
+	}
+}
+
+// purgeUser deletes the user and the data that is theirs alone. Games,
+// rounds, messages others sent them, standings and the audit trail are
+// shared or needed later, so their id there is replaced by a random
+// tombstone id instead; invites nobody can answer any more are cancelled.
+// It returns the tournaments the user played in.
+func purgeUser(tx *gorm.DB, userID string) ([]uint, error) {
+	args := map[string]interface{}{"id": userID}
+	var tournaments []uint
+	if err := tx.Model(&model.Game{}).Distinct("tournament_id").
+		Where("tournament_id <> 0 AND (sender = @id OR receiver = @id)", args).
+		Pluck("tournament_id", &tournaments).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&model.Game{}).
+		Where("status = @pending AND (sender = @id OR receiver = @id)",
+			map[string]interface{}{"id": userID, "pending": model.GameStatusPending}).
+		Update("status", model.GameStatusCancelled).Error; err != nil {
+		return nil, err
+	}
+
+	deletes := []struct {
+		model interface{}
+		query string
+	}{
+		{&model.Message{}, "sender = @id"},
+		{&model.Result{}, "user_id = @id"},
+		{&model.RatingChange{}, "user_id = @id"},
+		{&model.Device{}, "user_id = @id"},
+		{&model.RefreshToken{}, "user_id = @id"},
+		{&model.ActionToken{}, "user_id = @id"},
+		{&model.RecoveryCode{}, "user_id = @id"},
+		{&model.UserIdentity{}, "user_id = @id"},
+		{&model.APIKey{}, "user_id = @id"},
+		{&model.User{}, "id = @id"},
+	}
+	for _, d := range deletes {
+		if err := tx.Where(d.query, args).Delete(d.model).Error; err != nil {
+			return nil, fmt.Errorf("%T: %w", d.model, err)
+		}
+	}
+
+	tombstone := generateUUID()
+	anonymize := []struct {
+		model  interface{}
+		column string
+	}{
+		{&model.Game{}, "sender"},
+		{&model.Game{}, "receiver"},
+		{&model.Message{}, "receiver"},
+		{&model.RatingChange{}, "opponent"},
+		{&model.Tournament{}, "created_by"},
+		{&model.TournamentPlayer{}, "user_id"},
+		{&model.Season{}, "created_by"},
+		{&model.SeasonStanding{}, "user_id"},
+		{&model.AuditLog{}, "user_id"},
+	}
+	for _, a := range anonymize {
+		if err := tx.Model(a.model).Where(a.column+" = ?", userID).Update(a.column, tombstone).Error; err != nil {
+			return nil, fmt.Errorf("%T: %w", a.model, err)
+		}
+	}
+	return tournaments, nil
+}
+
+// ExportAccount returns everything we store about the current user, as a ZIP
+// with one JSON file per section (default) or as one JSON document
+// (?format=json). Secrets such as password and token hashes are left out.
+func (s *AuthService) ExportAccount(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	data, err := s.collectAccountData(userID)
+	if err != nil {
+		log.Printf("Failed to export account %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export data"})
+		return
+	}
+	s.audit(c, userID, auditDataExported, c.DefaultQuery("format", "zip"))
+
+	name := "halves-export-" + time.Now().UTC().Format("20060102")
+	switch c.DefaultQuery("format", "zip") {
+	case "json":
+		c.Header("Content-Disposition", `attachment; filename="`+name+`.json"`)
+		c.JSON(http.StatusOK, data)
+	case "zip":
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", `attachment; filename="`+name+`.zip"`)
+		c.Status(http.StatusOK)
+		zw := zip.NewWriter(c.Writer)
+		now := time.Now()
+		for _, section := range exportSections {
+			w, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     section + ".json",
+				Method:   zip.Deflate,
+				Modified: now,
+			})
+			if err != nil {
+				log.Printf("Failed to write export: %v", err)
+				return
+			}
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(data[section]); err != nil {
+				log.Printf("Failed to write export: %v", err)
+				return
+			}
+		}
+		if err := zw.Close(); err != nil {
+			log.Printf("Failed to write export: %v", err)
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be zip or json"})
+	}
+}
+
+// Sections of the export, in archive order
+var exportSections = []string{
+	"profile", "devices", "messages", "games", "rounds", "results",
+	"rating_history", "tournaments", "seasons", "sessions", "api_keys", "identities", "audit_log",
+}
+
+func (s *AuthService) collectAccountData(userID string) (map[string]interface{}, error) {
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	var (
+		devices    []model.Device
+		messages   []model.Message
+		games      []model.Game
+		rounds     []model.Round
+		results    []model.Result
+		ratings    []model.RatingChange
+		standings  []model.TournamentPlayer
+		seasons    []model.SeasonStanding
+		tokens     []model.RefreshToken
+		keys       []model.APIKey
+		identities []model.UserIdentity
+		audit      []model.AuditLog
+	)
+	queries := []struct {
+		dest  interface{}
+		query string
+	}{
+		{&devices, "user_id = @id"},
+		{&messages, "sender = @id OR receiver = @id"},
+		{&games, "sender = @id OR receiver = @id"},
+		{&rounds, "game_id IN (SELECT id FROM games WHERE sender = @id OR receiver = @id)"},
+		{&results, "user_id = @id"},
+		{&ratings, "user_id = @id"},
+		{&standings, "user_id = @id"},
+		{&seasons, "user_id = @id"},
+		{&tokens, "user_id = @id"},
+		{&keys, "user_id = @id"},
+		{&identities, "user_id = @id"},
+		{&audit, "user_id = @id"},
+	}
+	args := map[string]interface{}{"id": userID}
+	for _, q := range queries {
+		if err := s.db.Where(q.query, args).Find(q.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	data := map[string]interface{}{
+		"profile": gin.H{
+			"id":             user.ID,
+			"email":          user.Email,
+			"email_verified": user.EmailVerified,
+			"role":           user.Role,
+			"score":          user.Score,
+			"created_at":     user.CreatedAt,
+			"last_seen":      user.LastSeen,
+			"totp_enabled":   user.TOTPEnabled,
+			"delete_after":   user.DeleteAfter,
+		},
+	}
+	rows := func(n int, row func(i int) gin.H) []gin.H {
+		out := make([]gin.H, n)
+		for i := range out {
+			out[i] = row(i)
+		}
+		return out
+	}
+	data["devices"] = rows(len(devices), func(i int) gin.H {
+		d := devices[i]
+		return gin.H{"id": d.ID, "user_agent": d.UserAgent, "last_seen": d.LastSeen}
+	})
+	data["messages"] = rows(len(messages), func(i int) gin.H {
+		m := messages[i]
+		return gin.H{"id": m.ID, "sender": m.Sender, "receiver": m.Receiver, "content": m.Content, "created_at": m.CreatedAt, "delivered": m.Delivered}
+	})
+	data["games"] = rows(len(games), func(i int) gin.H {
+		g := games[i]
+		return gin.H{"id": g.ID, "sender": g.Sender, "receiver": g.Receiver, "created_at": g.Created, "svote": g.Svote, "rvote": g.Rvote, "status": g.Status, "type": g.Type, "rounds": g.Rounds, "sender_score": g.Sscore, "receiver_score": g.Rscore}
+	})
+	data["rounds"] = rows(len(rounds), func(i int) gin.H {
+		r := rounds[i]
+		return gin.H{"game_id": r.GameID, "number": r.Number, "svote": r.Svote, "rvote": r.Rvote, "sender_score": r.Sscore, "receiver_score": r.Rscore, "timed_out": r.TimedOut, "finished_at": r.CreatedAt}
+	})
+	data["results"] = rows(len(results), func(i int) gin.H {
+		r := results[i]
+		return gin.H{"score": r.Score, "rating": r.Rating, "rated_games": r.RatedGames, "last_updated": r.LastUpdated}
+	})
+	data["rating_history"] = rows(len(ratings), func(i int) gin.H {
+		r := ratings[i]
+		return gin.H{"game_id": r.GameID, "opponent": r.Opponent, "before": r.Before, "after": r.After, "created_at": r.CreatedAt}
+	})
+	data["tournaments"] = rows(len(standings), func(i int) gin.H {
+		p := standings[i]
+		return gin.H{"tournament_id": p.TournamentID, "games": p.Games, "wins": p.Wins, "losses": p.Losses, "draws": p.Draws, "points": p.Points, "rank": p.Rank}
+	})
+	data["seasons"] = rows(len(seasons), func(i int) gin.H {
+		p := seasons[i]
+		return gin.H{"season_id": p.SeasonID, "games": p.Games, "wins": p.Wins, "losses": p.Losses, "draws": p.Draws, "points": p.Points, "rank": p.Rank}
+	})
+	data["sessions"] = rows(len(tokens), func(i int) gin.H {
+		t := tokens[i]
+		return gin.H{"device_id": t.DeviceID, "created_at": t.CreatedAt, "expires_at": t.ExpiresAt, "used_at": t.UsedAt, "revoked_at": t.RevokedAt}
+	})
+	data["api_keys"] = rows(len(keys), func(i int) gin.H {
+		k := keys[i]
+		return gin.H{"name": k.Name, "prefix": k.Prefix, "scopes": k.Scopes, "created_at": k.CreatedAt, "last_used_at": k.LastUsedAt, "revoked_at": k.RevokedAt}
+	})
+	data["identities"] = rows(len(identities), func(i int) gin.H {
+		id := identities[i]
+		return gin.H{"provider": id.Provider, "subject": id.Subject, "email": id.Email, "created_at": id.CreatedAt}
+	})
+	data["audit_log"] = rows(len(audit), func(i int) gin.H {
+		e := audit[i]
+		return gin.H{"event": e.Event, "ip": e.IP, "user_agent": e.UserAgent, "detail": e.Detail, "created_at": e.CreatedAt}
+	})
+	return data, nil
+}
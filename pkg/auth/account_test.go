@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"halves/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestPurgeUser(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Message{}, &model.Device{}, &model.Game{},
+		&model.Result{}, &model.RefreshToken{}, &model.ActionToken{}, &model.RecoveryCode{},
+		&model.UserIdentity{}, &model.APIKey{}, &model.AuditLog{}, &model.Round{}, &model.TournamentPlayer{},
+		&model.RatingChange{}, &model.SeasonStanding{}, &model.Tournament{}, &model.Season{}))
+
+	now := time.Now().Unix()
+	for _, id := range []string{"gone", "kept", "other"} {
+		require.NoError(t, db.Create(&model.User{ID: id, Email: id + "@example.com", CreatedAt: now}).Error)
+		require.NoError(t, db.Create(&model.Device{ID: "dev-" + id, UserID: id, LastSeen: now}).Error)
+		require.NoError(t, db.Create(&model.Result{UserID: id, Score: 3}).Error)
+		require.NoError(t, db.Create(&model.AuditLog{UserID: id, Event: "login_succeeded", CreatedAt: now}).Error)
+	}
+	require.NoError(t, db.Create(&model.Message{Sender: "gone", Receiver: "kept", Content: "hi", CreatedAt: now}).Error)
+	require.NoError(t, db.Create(&model.Message{Sender: "kept", Receiver: "gone", Content: "hi", CreatedAt: now}).Error)
+	require.NoError(t, db.Create(&model.Message{Sender: "kept", Receiver: "other", Content: "hi", CreatedAt: now}).Error)
+	shared := model.Game{Sender: "kept", Receiver: "gone", Created: time.Now(), Status: model.GameStatusClosed, Sscore: 5, TournamentID: 7}
+	invite := model.Game{Sender: "gone", Receiver: "other", Created: time.Now(), Status: model.GameStatusPending}
+	kept := model.Game{Sender: "kept", Receiver: "other", Created: time.Now(), Status: model.GameStatusClosed}
+	for _, g := range []*model.Game{&shared, &invite, &kept} {
+		require.NoError(t, db.Create(g).Error)
+	}
+	require.NoError(t, db.Create(&model.Round{GameID: shared.ID, Number: 1, Sscore: 5, CreatedAt: now}).Error)
+	require.NoError(t, db.Create(&model.Round{GameID: kept.ID, Number: 1, CreatedAt: now}).Error)
+	require.NoError(t, db.Create(&model.Tournament{ID: 7, Name: "cup", CreatedBy: "gone", Status: model.TournamentFinished, CreatedAt: now}).Error)
+	require.NoError(t, db.Create(&model.TournamentPlayer{TournamentID: 7, UserID: "gone", Games: 1, Losses: 1, Rank: 2}).Error)
+	require.NoError(t, db.Create(&model.TournamentPlayer{TournamentID: 7, UserID: "kept", Games: 1, Wins: 1, Points: 5, Rank: 1}).Error)
+	require.NoError(t, db.Create(&model.SeasonStanding{SeasonID: 1, UserID: "gone", Rank: 1}).Error)
+	require.NoError(t, db.Create(&model.RatingChange{UserID: "gone", GameID: shared.ID, Opponent: "kept", CreatedAt: now}).Error)
+	require.NoError(t, db.Create(&model.RatingChange{UserID: "kept", GameID: shared.ID, Opponent: "gone", CreatedAt: now}).Error)
+	require.NoError(t, db.Create(&model.APIKey{ID: "k1", UserID: "gone", Name: "bot", Prefix: "hlv_aaaaaaaa", KeyHash: "x", Scopes: "games:play", CreatedAt: now}).Error)
+
+	tournaments, err := purgeUser(db, "gone")
+	require.NoError(t, err)
+	assert.Equal(t, []uint{7}, tournaments)
+
+	count := func(m interface{}, query string, args ...interface{}) int64 {
+		var n int64
+		require.NoError(t, db.Model(m).Where(query, args...).Count(&n).Error)
+		return n
+	}
+	// nothing refers to the user any more
+	assert.Zero(t, count(&model.User{}, "id = ?", "gone"))
+	assert.Zero(t, count(&model.Message{}, "sender = ? OR receiver = ?", "gone", "gone"))
+	assert.Zero(t, count(&model.Game{}, "sender = ? OR receiver = ?", "gone", "gone"))
+	assert.Zero(t, count(&model.RatingChange{}, "user_id = ? OR opponent = ?", "gone", "gone"))
+	assert.Zero(t, count(&model.Tournament{}, "created_by = ?", "gone"))
+	for _, m := range []interface{}{&model.Device{}, &model.Result{}, &model.APIKey{}, &model.AuditLog{},
+		&model.TournamentPlayer{}, &model.SeasonStanding{}} {
+		assert.Zero(t, count(m, "user_id = ?", "gone"))
+	}
+
+	// shared data stays, with one tombstone id in place of the user
+	require.NoError(t, db.First(&shared, shared.ID).Error)
+	tombstone := shared.Receiver
+	assert.NotEqual(t, "gone", tombstone)
+	assert.Equal(t, "kept", shared.Sender)
+	assert.Equal(t, 5, shared.Sscore)
+	require.NoError(t, db.First(&invite, invite.ID).Error)
+	assert.Equal(t, tombstone, invite.Sender)
+	assert.Equal(t, model.GameStatusCancelled, invite.Status)
+	assert.EqualValues(t, 2, count(&model.Round{}, "1 = 1"))
+	assert.EqualValues(t, 1, count(&model.Message{}, "sender = ? AND receiver = ?", "kept", tombstone))
+	assert.EqualValues(t, 1, count(&model.RatingChange{}, "user_id = ? AND opponent = ?", "kept", tombstone))
+	assert.EqualValues(t, 1, count(&model.TournamentPlayer{}, "user_id = ? AND rank = 2", tombstone))
+	assert.EqualValues(t, 1, count(&model.Tournament{}, "created_by = ?", tombstone))
+	assert.EqualValues(t, 1, count(&model.SeasonStanding{}, "user_id = ?", tombstone))
+	assert.EqualValues(t, 1, count(&model.AuditLog{}, "user_id = ?", tombstone))
+
+	// the other users are untouched
+	assert.EqualValues(t, 2, count(&model.User{}, "1 = 1"))
+	assert.EqualValues(t, 2, count(&model.Result{}, "1 = 1"))
+	assert.EqualValues(t, 3, count(&model.AuditLog{}, "1 = 1"))
+	assert.EqualValues(t, 1, count(&model.Message{}, "sender = ? AND receiver = ?", "kept", "other"))
+	assert.EqualValues(t, 1, count(&model.TournamentPlayer{}, "user_id = ? AND points = 5 AND rank = 1", "kept"))
+}
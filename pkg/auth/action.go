@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"errors"
+	"halves/pkg/mail"
+	"halves/pkg/model"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Purposes of emailed single-use tokens
+const (
+	purposePasswordReset = "pwd_reset"
+	purposeVerifyEmail   = "verify_email"
+	purposeMagicLogin    = "magic_login"
+	purposeChangeEmail   = "change_email"
+)
+
+var errActionTokenInvalid = errors.New("invalid or expired token")
+
+// createActionToken invalidates earlier unused tokens of the same purpose for
+// the user and stores a new one. The plaintext is only ever emailed.
+func createActionToken(db *gorm.DB, userID, purpose, data string, ttl time.Duration) (string, error) {
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.ActionToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at = 0", userID, purpose).
+			Update("used_at", now.Unix()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.ActionToken{
+			ID:        generateUUID(),
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hash,
+			Data:      data,
+			CreatedAt: now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeActionToken marks a valid token as used and returns it. The
+// conditional update makes sure a token can only be redeemed once.
+func consumeActionToken(tx *gorm.DB, token, purpose string) (*model.ActionToken, error) {
+	var row model.ActionToken
+	if err := tx.Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).
+		First(&row).Error; err != nil {
+		return nil, errActionTokenInvalid
+	}
+	now := time.Now().Unix()
+	if row.UsedAt != 0 || row.ExpiresAt < now {
+		return nil, errActionTokenInvalid
+	}
+
+	result := tx.Model(&model.ActionToken{}).
+		Where("id = ? AND used_at = 0", row.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errActionTokenInvalid
+	}
+	row.UsedAt = now
+	return &row, nil
+}
+
+// actionURL appends the token to the link configured in envKey, e.g.
+// PASSWORD_RESET_URL=https://example.com/reset?token=
+func actionURL(envKey, token string) string {
+	base := os.Getenv(envKey)
+	if base == "" {
+		return ""
+	}
+	return base + token
+}
+
+// sendMail renders the named template in the background so response times
+// don't reveal whether an address is registered
+func (s *AuthService) sendMail(to, template string, vars map[string]string) {
+	if s.mailer == nil {
+		log.Printf("No mailer configured, dropping %s email to %s", template, to)
+		return
+	}
+	go func() {
+		err := s.mailer.Send(mail.EmailTemplate{
+			TemplatePath: mail.TemplatePath(template),
+			Variables:    vars,
+			To:           to,
+		})
+		if err != nil {
+			log.Printf("Failed to send %s email: %v", template, err)
+		}
+	}()
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"halves/pkg/model"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActionTokenSingleUse(t *testing.T) {
+	s := newTestAuthService(t)
+
+	token, err := createActionToken(s.db, "user-1", purposeVerifyEmail, "a@example.com", time.Hour)
+	require.NoError(t, err)
+
+	_, err = consumeActionToken(s.db, token, purposePasswordReset)
+	assert.ErrorIs(t, err, errActionTokenInvalid, "a token only works for its purpose")
+
+	// concurrent redemptions: exactly one wins
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var consumed []*model.ActionToken
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			row, err := consumeActionToken(s.db, token, purposeVerifyEmail)
+			if err != nil {
+				assert.ErrorIs(t, err, errActionTokenInvalid)
+				return
+			}
+			mutex.Lock()
+			consumed = append(consumed, row)
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	require.Len(t, consumed, 1)
+	assert.Equal(t, "user-1", consumed[0].UserID)
+	assert.Equal(t, "a@example.com", consumed[0].Data)
+	assert.NotZero(t, consumed[0].UsedAt)
+
+	_, err = consumeActionToken(s.db, token, purposeVerifyEmail)
+	assert.ErrorIs(t, err, errActionTokenInvalid)
+}
+
+func TestActionTokenExpiry(t *testing.T) {
+	s := newTestAuthService(t)
+
+	expired, err := createActionToken(s.db, "user-1", purposePasswordReset, "", -time.Second)
+	require.NoError(t, err)
+	_, err = consumeActionToken(s.db, expired, purposePasswordReset)
+	assert.ErrorIs(t, err, errActionTokenInvalid)
+
+	// a newer token of the same purpose replaces the unused one
+	first, err := createActionToken(s.db, "user-1", purposePasswordReset, "", time.Hour)
+	require.NoError(t, err)
+	other, err := createActionToken(s.db, "user-1", purposeVerifyEmail, "", time.Hour)
+	require.NoError(t, err)
+	second, err := createActionToken(s.db, "user-1", purposePasswordReset, "", time.Hour)
+	require.NoError(t, err)
+
+	_, err = consumeActionToken(s.db, first, purposePasswordReset)
+	assert.ErrorIs(t, err, errActionTokenInvalid)
+	_, err = consumeActionToken(s.db, second, purposePasswordReset)
+	assert.NoError(t, err)
+	_, err = consumeActionToken(s.db, other, purposeVerifyEmail)
+	assert.NoError(t, err, "other purposes are left alone")
+
+	var stored model.ActionToken
+	require.NoError(t, s.db.Where("token_hash = ?", hashToken(second)).First(&stored).Error)
+	assert.NotEqual(t, second, stored.TokenHash, "only the hash is stored")
+}
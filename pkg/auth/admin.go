@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"errors"
+	"halves/pkg/model"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PromoteAdmins gives the admin role to the users listed in ADMIN_EMAILS, so
+// that a fresh installation has someone who can hand out roles
+func (s *AuthService) PromoteAdmins() {
+	var emails []string
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = normalizeEmail(email); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	if len(emails) == 0 {
+		return
+	}
+	if err := s.db.Model(&model.User{}).
+		Where("LOWER(email) IN ?", emails).
+		Update("role", model.RoleAdmin).Error; err != nil {
+		log.Println("Failed to promote admins:", err)
+	}
+}
+
+// SetUserRole changes the role of another user (admin only)
+func (s *AuthService) SetUserRole(c *gin.Context) {
+	var req struct {
+		Role string `json:"role" binding:"required,oneof=user moderator admin"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	adminID := c.MustGet("userID").(string)
+	targetID := c.Param("id")
+
+	// Keeps at least one admin around
+	if targetID == adminID {
+		c.JSON(http.StatusConflict, gin.H{"error": "you can't change your own role"})
+		return
+	}
+
+	result := s.db.Model(&model.User{}).Where("id = ?", targetID).Update("role", req.Role)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update role"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	s.audit(c, adminID, auditRoleChanged, targetID+" "+req.Role)
+
+	c.JSON(http.StatusOK, gin.H{"id": targetID, "role": req.Role})
+}
+
+// DeleteUser deletes another user right away, with everything purgeUser
+// removes (admin only)
+func (s *AuthService) DeleteUser(c *gin.Context) {
+	adminID := c.MustGet("userID").(string)
+	targetID := c.Param("id")
+
+	// Keeps at least one admin around
+	if targetID == adminID {
+		c.JSON(http.StatusConflict, gin.H{"error": "you can't delete yourself"})
+		return
+	}
+
+	var tournaments []uint
+	err := s.db.Transaction(func(tx *gorm.DB) (err error) {
+		if err := tx.Select("id").Where("id = ?", targetID).First(&model.User{}).Error; err != nil {
+			return err
+		}
+		tournaments, err = purgeUser(tx, targetID)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete user"})
+		return
+	}
+	if s.sessions != nil {
+		s.sessions.DisconnectUser(targetID)
+	}
+	s.finishTournaments(tournaments)
+	s.audit(c, adminID, auditUserDeleted, targetID)
+
+	c.JSON(http.StatusOK, gin.H{"status": "user deleted"})
+}
+
+// ListAuditLogs returns the newest audit entries, optionally filtered by
+// ?user_id= and ?event= (admin only)
+func (s *AuthService) ListAuditLogs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+		return
+	}
+
+	query := s.db.Order("id DESC").Limit(limit)
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+	if before := c.Query("before"); before != "" {
+		query = query.Where("id < ?", before)
+	}
+
+	var entries []model.AuditLog
+	if err := query.Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get audit log"})
+		return
+	}
+	response := make([]gin.H, len(entries))
+	for i, e := range entries {
+		response[i] = gin.H{
+			"id":         e.ID,
+			"user_id":    e.UserID,
+			"event":      e.Event,
+			"ip":         e.IP,
+			"user_agent": e.UserAgent,
+			"detail":     e.Detail,
+			"created_at": e.CreatedAt,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": response})
+}
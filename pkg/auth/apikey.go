@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"halves/pkg/model"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// API key scopes
+const (
+	ScopeMessagesSend = "messages:send"
+	ScopeMessagesRead = "messages:read"
+	ScopeGamesPlay    = "games:play"
+	ScopeResultsRead  = "results:read"
+)
+
+var apiKeyScopes = map[string]bool{
+	ScopeMessagesSend: true,
+	ScopeMessagesRead: true,
+	ScopeGamesPlay:    true,
+	ScopeResultsRead:  true,
+}
+
+const (
+	// Keys look like hlv_<8 char id>_<secret>; the id part makes them easy
+	// to spot in logs and secret scanners and lets us look them up
+	apiKeyPrefix   = "hlv_"
+	apiKeyIDLength = 8
+	maxAPIKeys     = 20
+	// last_used_at is written at most this often per key
+	apiKeyTouchInterval = time.Minute
+)
+
+var errAPIKeyInvalid = errors.New("invalid api key")
+
+// newAPIKey returns the full key and its public prefix
+func newAPIKey() (string, string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	prefix := apiKeyPrefix + strings.ToLower(totpEncoding.EncodeToString(buf))[:apiKeyIDLength]
+	secret, _, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	return prefix + "_" + secret, prefix, nil
+}
+
+// splitAPIKey returns the prefix of a well-formed key
+func splitAPIKey(key string) (string, bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", false
+	}
+	n := len(apiKeyPrefix) + apiKeyIDLength
+	if len(key) <= n+1 || key[n] != '_' {
+		return "", false
+	}
+	return key[:n], true
+}
+
+// lookupAPIKey finds the active key row for a presented key
+func lookupAPIKey(db *gorm.DB, key string) (*model.APIKey, error) {
+	prefix, ok := splitAPIKey(key)
+	if !ok {
+		return nil, errAPIKeyInvalid
+	}
+	var row model.APIKey
+	if err := db.Where("prefix = ?", prefix).First(&row).Error; err != nil {
+		return nil, errAPIKeyInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(row.KeyHash), []byte(hashToken(key))) != 1 {
+		return nil, errAPIKeyInvalid
+	}
+	now := time.Now().Unix()
+	if row.RevokedAt != 0 || (row.ExpiresAt != 0 && row.ExpiresAt < now) {
+		return nil, errAPIKeyInvalid
+	}
+
+	if row.LastUsedAt < now-int64(apiKeyTouchInterval.Seconds()) {
+		db.Model(&model.APIKey{}).Where("id = ?", row.ID).Update("last_used_at", now)
+	}
+	return &row, nil
+}
+
+// authenticateAPIKey is the JWTMiddleware branch for API keys. It sets the
+// same userID as a token would, plus the key's scopes.
+func authenticateAPIKey(c *gin.Context, key string) {
+	db := c.MustGet("db").(*gorm.DB)
+	row, err := lookupAPIKey(db, key)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or revoked API key"})
+		return
+	}
+	c.Set("userID", row.UserID)
+	c.Set("apiKeyID", row.ID)
+	c.Set("scopes", strings.Fields(row.Scopes))
+	c.Next()
+}
+
+// RequireScope lets API keys through only if they carry one of the scopes.
+// Requests authenticated with a user token are not restricted.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted, isKey := c.Get("scopes")
+		if !isKey {
+			c.Next()
+			return
+		}
+		for _, have := range granted.([]string) {
+			for _, want := range scopes {
+				if have == want {
+					c.Next()
+					return
+				}
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "API key lacks scope " + strings.Join(scopes, " or "),
+		})
+	}
+}
+
+// RequireUserToken rejects API keys on endpoints that manage the account
+// itself (2FA, sessions, keys, logout)
+func RequireUserToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isKey := c.Get("apiKeyID"); isKey {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API keys can't be used here"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func apiKeyJSON(k *model.APIKey) gin.H {
+	return gin.H{
+		"id":           k.ID,
+		"name":         k.Name,
+		"prefix":       k.Prefix,
+		"scopes":       strings.Fields(k.Scopes),
+		"created_at":   k.CreatedAt,
+		"last_used_at": k.LastUsedAt,
+		"expires_at":   k.ExpiresAt,
+	}
+}
+
+// CreateAPIKey issues a new key. The key itself is only returned here.
+func (s *AuthService) CreateAPIKey(c *gin.Context) {
+	var req struct {
+		Name          string   `json:"name" binding:"required,max=100"`
+		Scopes        []string `json:"scopes" binding:"required,min=1"`
+		ExpiresInDays int      `json:"expires_in_days" binding:"min=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.MustGet("userID").(string)
+
+	seen := map[string]bool{}
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !apiKeyScopes[scope] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope " + scope})
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+
+	var count int64
+	s.db.Model(&model.APIKey{}).Where("user_id = ? AND revoked_at = 0", userID).Count(&count)
+	if count >= maxAPIKeys {
+		c.JSON(http.StatusConflict, gin.H{"error": "too many API keys, revoke one first"})
+		return
+	}
+
+	key, prefix, err := newAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create API key"})
+		return
+	}
+	now := time.Now()
+	row := model.APIKey{
+		ID:        generateUUID(),
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hashToken(key),
+		Scopes:    strings.Join(scopes, " "),
+		CreatedAt: now.Unix(),
+	}
+	if req.ExpiresInDays > 0 {
+		row.ExpiresAt = now.AddDate(0, 0, req.ExpiresInDays).Unix()
+	}
+	if err := s.db.Create(&row).Error; err != nil {
+		log.Printf("Failed to create API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create API key"})
+		return
+	}
+	s.audit(c, userID, auditAPIKeyCreated, prefix)
+
+	resp := apiKeyJSON(&row)
+	resp["key"] = key
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListAPIKeys returns the user's active keys without the secrets
+func (s *AuthService) ListAPIKeys(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	var rows []model.APIKey
+	if err := s.db.Where("user_id = ? AND revoked_at = 0", userID).
+		Order("created_at DESC").Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get API keys"})
+		return
+	}
+	keys := make([]gin.H, 0, len(rows))
+	for i := range rows {
+		keys = append(keys, apiKeyJSON(&rows[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// RevokeAPIKey disables a key immediately
+func (s *AuthService) RevokeAPIKey(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	result := s.db.Model(&model.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at = 0", c.Param("id"), userID).
+		Update("revoked_at", time.Now().Unix())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke API key"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	s.audit(c, userID, auditAPIKeyRevoked, c.Param("id"))
+
+	c.JSON(http.StatusOK, gin.H{"status": "API key revoked"})
+}
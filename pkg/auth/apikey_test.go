@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"halves/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestAPIKeyFormat(t *testing.T) {
+	key, prefix, err := newAPIKey()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, prefix+"_"))
+	assert.Len(t, prefix, len(apiKeyPrefix)+apiKeyIDLength)
+
+	got, ok := splitAPIKey(key)
+	assert.True(t, ok)
+	assert.Equal(t, prefix, got)
+
+	for _, bad := range []string{"", "hlv_", "hlv_abcdefgh", "hlv_abcdefgh_", "hlv_abcdefghXsecret", "eyJhbGciOi"} {
+		_, ok := splitAPIKey(bad)
+		assert.False(t, ok, bad)
+	}
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&model.APIKey{}))
+
+	store := func(scopes string, expiresAt, revokedAt int64) string {
+		key, prefix, err := newAPIKey()
+		require.NoError(t, err)
+		require.NoError(t, db.Create(&model.APIKey{
+			ID: generateUUID(), UserID: "bot-1", Name: "bot", Prefix: prefix,
+			KeyHash: hashToken(key), Scopes: scopes, CreatedAt: time.Now().Unix(),
+			ExpiresAt: expiresAt, RevokedAt: revokedAt,
+		}).Error)
+		return key
+	}
+	playKey := store("games:play results:read", 0, 0)
+	revokedKey := store("games:play", 0, time.Now().Unix())
+	expiredKey := store("games:play", time.Now().Add(-time.Hour).Unix(), 0)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("db", db) })
+	ok := func(c *gin.Context) { c.String(http.StatusOK, c.GetString("userID")) }
+	r.POST("/game/vote", JWTMiddleware(), RequireScope(ScopeGamesPlay), ok)
+	r.POST("/send", JWTMiddleware(), RequireScope(ScopeMessagesSend), ok)
+	r.POST("/logout", JWTMiddleware(), RequireUserToken(), ok)
+
+	call := func(path, header, value string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set(header, value)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("/game/vote", "Authorization", "Bearer "+playKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "bot-1", w.Body.String())
+	assert.Equal(t, http.StatusOK, call("/game/vote", "X-API-Key", playKey).Code)
+
+	assert.Equal(t, http.StatusForbidden, call("/send", "X-API-Key", playKey).Code)
+	assert.Equal(t, http.StatusForbidden, call("/logout", "X-API-Key", playKey).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, call("/game/vote", "X-API-Key", revokedKey).Code)
+	assert.Equal(t, http.StatusUnauthorized, call("/game/vote", "X-API-Key", expiredKey).Code)
+	// Right prefix, wrong secret
+	assert.Equal(t, http.StatusUnauthorized, call("/game/vote", "X-API-Key", playKey[:len(playKey)-2]+"xx").Code)
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"halves/pkg/model"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audit events
+const (
+	auditLoginSucceeded       = "login_succeeded"
+	auditLoginFailed          = "login_failed"
+	auditLoginThrottled       = "login_throttled"
+	auditAccountLocked        = "account_locked"
+	auditIPLocked             = "ip_locked"
+	auditIdentityLinked       = "identity_linked"
+	auditAPIKeyCreated        = "api_key_created"
+	auditAPIKeyRevoked        = "api_key_revoked"
+	auditRoleChanged          = "role_changed"
+	auditDeletionRequested    = "deletion_requested"
+	auditDeletionCancelled    = "deletion_cancelled"
+	auditDataExported         = "data_exported"
+	auditEmailChangeRequested = "email_change_requested"
+	auditEmailChanged         = "email_changed"
+	auditUserDeleted          = "user_deleted"
+)
+
+// audit stores an audit entry for the request. Failures are only logged so
+// auditing never breaks the request itself.
+func (s *AuthService) audit(c *gin.Context, userID, event, detail string) {
+	entry := model.AuditLog{
+		UserID:    userID,
+		Event:     event,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Detail:    detail,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := s.db.Create(&entry).Error; err != nil {
+		log.Printf("Failed to write audit entry %s: %v", event, err)
+	}
+}
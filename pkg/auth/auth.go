@@ -1,28 +1,37 @@
 package auth
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
+	"errors"
+	"halves/pkg/mail"
 	"halves/pkg/model"
 	"log"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 )
 
 type AuthService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	sessions SessionCloser
+	mailer   mail.Sender
+	oidc     map[string]*oidcProvider
+
+	tournaments TournamentFinisher // optional, see SetTournaments
 }
 
-func NewAuthService(db *gorm.DB) *AuthService {
-	return &AuthService{db: db}
+func NewAuthService(db *gorm.DB, sessions SessionCloser, mailer mail.Sender) *AuthService {
+	if err := revoked.load(db); err != nil {
+		log.Println("Failed to load revoked tokens:", err)
+	}
+	providers, err := loadOIDCProviders()
+	if err != nil {
+		log.Println("Failed to load OIDC providers:", err)
+	}
+	return &AuthService{db: db, sessions: sessions, mailer: mailer, oidc: providers}
 }
 
 func (s *AuthService) Register(c *gin.Context) {
@@ -37,7 +46,7 @@ func (s *AuthService) Register(c *gin.Context) {
 	}
 
 	var existing model.User
-	if result := s.db.Where("email = ?", req.Email).First(&existing); result.Error == nil {
+	if result := s.db.Where("LOWER(email) = ?", normalizeEmail(req.Email)).First(&existing); result.Error == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "user already exists"})
 		return
 	}
@@ -62,7 +71,11 @@ func (s *AuthService) Register(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"id": user.ID, "email": user.Email})
+	if err := s.sendVerificationEmail(&user); err != nil {
+		log.Printf("Failed to send verification email: %v", err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": user.ID, "email": user.Email, "email_verified": user.EmailVerified})
 }
 
 func (s *AuthService) Login(c *gin.Context) {
@@ -76,58 +89,76 @@ func (s *AuthService) Login(c *gin.Context) {
 		return
 	}
 
+	email := normalizeEmail(req.Email)
 	var user model.User
-	if result := s.db.Where("email = ?", req.Email).First(&user); result.Error != nil {
+	if result := s.db.Where("LOWER(email) = ?", email).First(&user); result.Error != nil {
+		if s.loginBlocked(c, "", email) {
+			return
+		}
+		s.loginFailed(c, nil, email, "unknown email")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
+	if s.loginBlocked(c, user.ID, email) {
+		return
+	}
 
-	if !checkPassword(req.Password, user.Password) {
+	ok, rehash := verifyPassword(req.Password, user.Password)
+	if !ok {
+		s.loginFailed(c, &user, email, "bad password")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
 
-	// Decode base64-encoded secret
-	secret, err := base64.RawStdEncoding.DecodeString(os.Getenv("JWT_SECRET"))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid jwt secret configuration"})
+	// Upgrade legacy or outdated hashes while we know the plaintext
+	if rehash {
+		if hashed, err := hashPassword(req.Password); err == nil {
+			if err := s.db.Model(&user).Update("password", hashed).Error; err != nil {
+				log.Printf("Failed to rehash password for %s: %v", user.ID, err)
+			}
+		}
+	}
+
+	s.finishLogin(c, &user, c.GetHeader("X-Device-ID"), "password")
+}
+
+// finishLogin completes a login once the first factor was accepted. Users with
+// 2FA get a challenge for /login/2fa, everyone else a token pair for deviceID.
+func (s *AuthService) finishLogin(c *gin.Context, user *model.User, deviceID, method string) {
+	if user.TOTPEnabled {
+		challenge, exp, err := newMFAChallenge(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required":    true,
+			"challenge_token": challenge,
+			"expires_in":      exp,
+		})
 		return
 	}
 
-	// Create token with additional claims
-	exp := time.Now().Add(time.Hour * 24).Unix()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": user.ID, // Subject
-		"exp": exp,     // Expiration
+	var pair *tokenPair
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pair, err = s.issueTokens(tx, user.ID, deviceID, "")
+		return err
 	})
-
-	tokenString, err := token.SignedString(secret)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
 		return
 	}
+	s.loginSucceeded(c, user, method)
+	s.touchDevice(c, pair.UserID, deviceID)
+	respondWithTokens(c, pair)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token":      tokenString,
-		"expires_in": exp,
-		"uuid":       user.ID,
-	})
-
-	// token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-	// 	"sub": user.ID,
-	// 	"exp": time.Now().Add(time.Hour * 24).Unix(),
-	// })
-
-	// tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
-	// if err != nil {
-	// 	c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
-	// 	return
-	// }
-
-	// c.JSON(http.StatusOK, gin.H{"token": tokenString})
+func passwordResetTTL() time.Duration {
+	return envDuration("PASSWORD_RESET_TTL", 10*time.Minute)
 }
 
-// JWT Middleware and utility functions remain the same
+// RequestPasswordReset emails a single-use reset token
 func (s *AuthService) RequestPasswordReset(c *gin.Context) {
 	var req struct {
 		Email string `json:"email" binding:"required,email"`
@@ -139,28 +170,31 @@ func (s *AuthService) RequestPasswordReset(c *gin.Context) {
 	}
 
 	var user model.User
-	if result := s.db.Where("email = ?", req.Email).First(&user); result.Error != nil {
+	if result := s.db.Where("LOWER(email) = ?", normalizeEmail(req.Email)).First(&user); result.Error != nil {
 		// Don't reveal if email exists
 		c.JSON(http.StatusOK, gin.H{"status": "reset link sent if email exists"})
 		return
 	}
 
-	// Call Python microservice
-	webhookURL := os.Getenv("EMAIL_WEBHOOK")
-	payload := map[string]interface{}{
-		"email":      user.Email,
-		"user_id":    user.ID,
-		"expires_at": time.Now().Add(10 * time.Minute).Unix(),
-	}
-	jsonPayload, err := json.Marshal(payload)
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewBuffer(jsonPayload))
-	if err != nil || resp.StatusCode != 200 {
-		log.Printf("Failed to call email webhook: %v", err)
+	ttl := passwordResetTTL()
+	token, err := createActionToken(s.db, user.ID, purposePasswordReset, "", ttl)
+	if err != nil {
+		log.Printf("Failed to create reset token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create reset token"})
+		return
 	}
 
+	s.sendMail(user.Email, "reset", map[string]string{
+		"TOKEN":      token,
+		"RESET_URL":  actionURL("PASSWORD_RESET_URL", token),
+		"EXPIRES_IN": strconv.Itoa(int(ttl.Minutes())),
+	})
+
 	c.JSON(http.StatusOK, gin.H{"status": "reset link sent if email exists"})
 }
 
+// ResetPassword redeems a reset token, sets the new password and logs the
+// user out of every existing session
 func (s *AuthService) ResetPassword(c *gin.Context) {
 	var req struct {
 		Token    string `json:"token" binding:"required"`
@@ -171,51 +205,49 @@ func (s *AuthService) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	// Decode secret
-	secretB, err := base64.RawStdEncoding.DecodeString(os.Getenv("JWT_SECRET"))
+	// Hash new password
+	hashed, err := hashPassword(req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
 		return
 	}
 
-	// Parse & validate JWT
-	parsed, err := jwt.Parse(req.Token, func(token *jwt.Token) (interface{}, error) {
-		if token.Method != jwt.SigningMethodHS256 {
-			return nil, fmt.Errorf("unexpected signing method")
+	var user model.User
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeActionToken(tx, req.Token, purposePasswordReset)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", token.UserID).First(&user).Error; err != nil {
+			return err
 		}
-		return secretB, nil
+
+		// Update user record
+		if err := tx.Model(&user).Update("password", hashed).Error; err != nil {
+			return err
+		}
+		// A pending email change may have been started by whoever knew
+		// the old password
+		if err := tx.Model(&model.ActionToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at = 0", user.ID, purposeChangeEmail).
+			Update("used_at", time.Now().Unix()).Error; err != nil {
+			return err
+		}
+		// Proving access to the mailbox lifts a lockout
+		return tx.Where("scope = ? AND key = ?", scopeAccount, normalizeEmail(user.Email)).
+			Delete(&model.LoginThrottle{}).Error
 	})
-	if err != nil || !parsed.Valid {
+	if errors.Is(err, errActionTokenInvalid) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
 		return
 	}
-
-	claims, ok := parsed.Claims.(jwt.MapClaims)
-	if !ok || claims["typ"] != "pwd_reset" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token claims"})
-		return
-	}
-
-	userID, ok := claims["sub"].(string)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token subject"})
-		return
-	}
-
-	// Hash new password
-	hashed, err := hashPassword(req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update password"})
 		return
 	}
 
-	// Update user record
-	if err := s.db.Model(&model.User{}).
-		Where("id = ?", userID).
-		Update("password", hashed).Error; err != nil {
-
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update password"})
-		return
+	if err := s.RevokeUserSessions(user.ID); err != nil {
+		log.Printf("Failed to revoke sessions after password reset: %v", err)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "password reset successful"})
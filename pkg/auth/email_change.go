@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"errors"
+	"halves/pkg/model"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errEmailTaken = errors.New("email already registered")
+
+func emailChangeTTL() time.Duration {
+	return envDuration("EMAIL_CHANGE_TTL", 24*time.Hour)
+}
+
+// maskEmail hides most of the local part: jane.doe@example.com -> j*******@example.com
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return email
+	}
+	return email[:1] + strings.Repeat("*", at-1) + email[at:]
+}
+
+// emailTaken reports whether another user already uses the address,
+// ignoring case
+func emailTaken(db *gorm.DB, email, userID string) (bool, error) {
+	var n int64
+	err := db.Model(&model.User{}).
+		Where("LOWER(email) = ? AND id <> ?", normalizeEmail(email), userID).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// RequestEmailChange mails a confirmation token to the new address and warns
+// the current one. The email only changes once the token is redeemed.
+func (s *AuthService) RequestEmailChange(c *gin.Context) {
+	var req struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.MustGet("userID").(string)
+
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.Password == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "set a password through password reset first"})
+		return
+	}
+	if ok, _ := verifyPassword(req.Password, user.Password); !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+	if normalizeEmail(req.Email) == normalizeEmail(user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "that is already your email address"})
+		return
+	}
+	if taken, err := emailTaken(s.db, req.Email, user.ID); err != nil || taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "email already registered"})
+		return
+	}
+
+	ttl := emailChangeTTL()
+	token, err := createActionToken(s.db, user.ID, purposeChangeEmail, req.Email, ttl)
+	if err != nil {
+		log.Printf("Failed to create email change token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+
+	s.sendMail(req.Email, "change_email", map[string]string{
+		"TOKEN":       token,
+		"CONFIRM_URL": actionURL("EMAIL_CHANGE_URL", token),
+		"EXPIRES_IN":  strconv.Itoa(int(ttl.Hours())),
+	})
+	s.sendMail(user.Email, "email_notice", map[string]string{
+		"NEW_EMAIL": maskEmail(req.Email),
+	})
+	s.audit(c, user.ID, auditEmailChangeRequested, req.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "confirmation sent to the new address"})
+}
+
+// ConfirmEmailChange redeems the token from the new address and switches
+// the account over to it
+func (s *AuthService) ConfirmEmailChange(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user model.User
+	var newEmail string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeActionToken(tx, req.Token, purposeChangeEmail)
+		if err != nil {
+			return err
+		}
+		newEmail = token.Data
+		if err := tx.Where("id = ?", token.UserID).First(&user).Error; err != nil {
+			return errActionTokenInvalid
+		}
+
+		// The address may have been taken since the request. The check
+		// runs in the same statement as the update, and the unique index
+		// catches anything that slips through.
+		result := tx.Exec(`
+			UPDATE users SET email = ?, email_verified = true
+			WHERE id = ? AND NOT EXISTS (
+				SELECT 1 FROM users WHERE LOWER(email) = ? AND id <> ?
+			)`,
+			newEmail, user.ID, normalizeEmail(newEmail), user.ID)
+		if result.Error != nil {
+			if strings.Contains(strings.ToLower(result.Error.Error()), "unique") {
+				return errEmailTaken
+			}
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errEmailTaken
+		}
+
+		// Links for the old address (verification, password reset, login)
+		// must not work any more
+		return tx.Model(&model.ActionToken{}).
+			Where("user_id = ? AND used_at = 0", user.ID).
+			Update("used_at", time.Now().Unix()).Error
+	})
+	if errors.Is(err, errActionTokenInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		return
+	}
+	if errors.Is(err, errEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "email already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change email"})
+		return
+	}
+
+	s.sendMail(user.Email, "email_notice", map[string]string{
+		"NEW_EMAIL": maskEmail(newEmail),
+		"CHANGED":   "1",
+	})
+	s.audit(c, user.ID, auditEmailChanged, user.Email+" -> "+newEmail)
+
+	c.JSON(http.StatusOK, gin.H{"status": "email changed", "email": newEmail})
+}
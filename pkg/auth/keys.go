@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// legacyKeyID identifies the JWT_SECRET key. Tokens without a kid header were
+// signed with it before key rotation existed.
+const legacyKeyID = "legacy"
+
+// signingKey is one entry of the key ring. Each key is pinned to exactly one
+// algorithm; a token is only accepted if its header matches it.
+type signingKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	sign      interface{} // nil for verify-only keys
+	verify    interface{}
+	RetiredAt time.Time // zero while the key is current
+}
+
+// KeyRing signs tokens with the active key and verifies them with any key
+// that is current or retired less than the grace period ago
+type KeyRing struct {
+	active *signingKey
+	keys   map[string]*signingKey
+	grace  time.Duration
+}
+
+// keyFile is the JSON document JWT_KEYS_FILE points to
+type keyFile struct {
+	Active string `json:"active"`
+	Keys   []struct {
+		KID        string `json:"kid"`
+		Alg        string `json:"alg"`         // HS256, EdDSA or ES256
+		Secret     string `json:"secret"`      // HS256, base64
+		PrivateKey string `json:"private_key"` // PEM file, relative to the keys file
+		PublicKey  string `json:"public_key"`  // PEM file, for verify-only keys
+		RetiredAt  string `json:"retired_at"`  // RFC 3339
+	} `json:"keys"`
+}
+
+var (
+	keyRingMu sync.RWMutex
+	keyRing   *KeyRing
+)
+
+// SetKeyRing installs the ring used to sign and verify every token
+func SetKeyRing(ring *KeyRing) {
+	keyRingMu.Lock()
+	keyRing = ring
+	keyRingMu.Unlock()
+}
+
+// currentKeyRing returns the installed ring, loading it from the environment
+// on first use
+func currentKeyRing() (*KeyRing, error) {
+	keyRingMu.RLock()
+	ring := keyRing
+	keyRingMu.RUnlock()
+	if ring != nil {
+		return ring, nil
+	}
+
+	ring, err := LoadKeyRing()
+	if err != nil {
+		return nil, err
+	}
+	SetKeyRing(ring)
+	return ring, nil
+}
+
+// LoadKeyRing builds the ring from JWT_KEYS_FILE and/or JWT_SECRET. Without a
+// keys file the JWT_SECRET key signs everything, as before.
+func LoadKeyRing() (*KeyRing, error) {
+	ring := &KeyRing{
+		keys:  make(map[string]*signingKey),
+		grace: envDuration("JWT_KEY_GRACE", 24*time.Hour),
+	}
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		key, err := hmacKey(legacyKeyID, secret)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_SECRET: %w", err)
+		}
+		ring.keys[key.ID] = key
+		ring.active = key
+	}
+
+	if path := os.Getenv("JWT_KEYS_FILE"); path != "" {
+		if err := ring.loadFile(path); err != nil {
+			return nil, fmt.Errorf("JWT_KEYS_FILE: %w", err)
+		}
+	}
+
+	if ring.active == nil {
+		return nil, errors.New("no jwt signing key configured")
+	}
+	return ring, nil
+}
+
+func (r *KeyRing) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var cfg keyFile
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to parse: %w", err)
+	}
+	dir := filepath.Dir(path)
+
+	for _, k := range cfg.Keys {
+		if k.KID == "" {
+			return errors.New("key without kid")
+		}
+		if _, dup := r.keys[k.KID]; dup {
+			return fmt.Errorf("duplicate kid %q", k.KID)
+		}
+
+		var key *signingKey
+		switch k.Alg {
+		case jwt.SigningMethodHS256.Alg():
+			key, err = hmacKey(k.KID, k.Secret)
+		case jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodES256.Alg():
+			key, err = asymmetricKey(k.KID, k.Alg, resolvePath(dir, k.PrivateKey), resolvePath(dir, k.PublicKey))
+		default:
+			err = fmt.Errorf("unsupported alg %q", k.Alg)
+		}
+		if err != nil {
+			return fmt.Errorf("key %q: %w", k.KID, err)
+		}
+
+		if k.RetiredAt != "" {
+			if key.RetiredAt, err = time.Parse(time.RFC3339, k.RetiredAt); err != nil {
+				return fmt.Errorf("key %q: invalid retired_at: %w", k.KID, err)
+			}
+		}
+		r.keys[key.ID] = key
+	}
+
+	if cfg.Active != "" {
+		active, ok := r.keys[cfg.Active]
+		switch {
+		case !ok:
+			return fmt.Errorf("active key %q not found", cfg.Active)
+		case active.sign == nil:
+			return fmt.Errorf("active key %q has no private key", cfg.Active)
+		case !active.RetiredAt.IsZero() && !active.RetiredAt.After(time.Now()):
+			return fmt.Errorf("active key %q is retired", cfg.Active)
+		}
+		r.active = active
+	}
+	return nil
+}
+
+func resolvePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func hmacKey(kid, encoded string) (*signingKey, error) {
+	secret, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		secret, err = base64.StdEncoding.DecodeString(encoded)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 secret: %w", err)
+	}
+	if len(secret) < 32 {
+		return nil, errors.New("secret must be at least 32 bytes")
+	}
+	return &signingKey{ID: kid, Method: jwt.SigningMethodHS256, sign: secret, verify: secret}, nil
+}
+
+func asymmetricKey(kid, alg, privatePath, publicPath string) (*signingKey, error) {
+	key := &signingKey{ID: kid, Method: jwt.GetSigningMethod(alg)}
+
+	switch {
+	case privatePath != "":
+		block, err := readPEM(privatePath)
+		if err != nil {
+			return nil, err
+		}
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			// openssl ecparam writes SEC1 keys
+			if ec, ecErr := x509.ParseECPrivateKey(block.Bytes); ecErr == nil {
+				priv, err = ec, nil
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", priv)
+		}
+		key.sign, key.verify = priv, signer.Public()
+	case publicPath != "":
+		block, err := readPEM(publicPath)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		key.verify = pub
+	default:
+		return nil, errors.New("private_key or public_key required")
+	}
+
+	// Make sure the key material matches the pinned algorithm
+	switch pub := key.verify.(type) {
+	case ed25519.PublicKey:
+		if alg != jwt.SigningMethodEdDSA.Alg() {
+			return nil, fmt.Errorf("ed25519 key can't be used with %s", alg)
+		}
+	case *ecdsa.PublicKey:
+		if alg != jwt.SigningMethodES256.Alg() || pub.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("ES256 requires a P-256 key")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in %s", path)
+	}
+	return block, nil
+}
+
+// usable reports whether tokens signed with the key are still accepted
+func (k *signingKey) usable(now time.Time, grace time.Duration) bool {
+	return k.RetiredAt.IsZero() || now.Before(k.RetiredAt.Add(grace))
+}
+
+// Sign signs the claims with the active key and sets its kid header
+func (r *KeyRing) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(r.active.Method, claims)
+	token.Header["kid"] = r.active.ID
+	return token.SignedString(r.active.sign)
+}
+
+// Parse verifies a token against the key named by its kid header, insisting
+// on that key's algorithm. Tokens without kid fall back to the legacy key.
+func (r *KeyRing) Parse(tokenString string, opts ...jwt.ParserOption) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = legacyKeyID
+		}
+		key, ok := r.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		if !key.usable(time.Now(), r.grace) {
+			return nil, fmt.Errorf("key %q is retired", kid)
+		}
+		return key.verify, nil
+	}, append(opts, jwt.WithValidMethods(r.algorithms()))...)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+func (r *KeyRing) algorithms() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, key := range r.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// JWKS returns the public keys that verify our tokens. HMAC secrets are never
+// published, so services that verify tokens need an EdDSA or ES256 key.
+func (r *KeyRing) JWKS() []map[string]string {
+	now := time.Now()
+	keys := make([]map[string]string, 0, len(r.keys))
+	for _, key := range r.keys {
+		if !key.usable(now, r.grace) {
+			continue
+		}
+		jwk := map[string]string{"kid": key.ID, "alg": key.Method.Alg(), "use": "sig"}
+		switch pub := key.verify.(type) {
+		case ed25519.PublicKey:
+			jwk["kty"], jwk["crv"] = "OKP", "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		case *ecdsa.PublicKey:
+			jwk["kty"], jwk["crv"] = "EC", "P-256"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(padCoordinate(pub.X))
+			jwk["y"] = base64.RawURLEncoding.EncodeToString(padCoordinate(pub.Y))
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i]["kid"] < keys[j]["kid"] })
+	return keys
+}
+
+// padCoordinate left-pads a P-256 coordinate to 32 bytes as RFC 7518 requires
+func padCoordinate(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, 32))
+}
+
+// JWKSHandler serves /.well-known/jwks.json
+func JWKSHandler(c *gin.Context) {
+	ring, err := currentKeyRing()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server configuration error"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": ring.JWKS()})
+}
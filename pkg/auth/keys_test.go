@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "TlFuT3JUMWNXano4N2pVN0FmU3BuamRUdFNTTzAzMndBQzRmN1BBemtlbz0K"
+
+func writePrivateKey(t *testing.T, dir, name string, key interface{}) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0600))
+}
+
+func loadTestRing(t *testing.T, keysJSON string) *KeyRing {
+	dir := t.TempDir()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writePrivateKey(t, dir, "ed.pem", edKey)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	writePrivateKey(t, dir, "ec.pem", ecKey)
+
+	path := filepath.Join(dir, "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(keysJSON), 0600))
+
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("JWT_KEYS_FILE", path)
+	ring, err := LoadKeyRing()
+	require.NoError(t, err)
+	return ring
+}
+
+func claimsFor(sub string) jwt.MapClaims {
+	return jwt.MapClaims{"sub": sub, "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+func TestKeyRing(t *testing.T) {
+	retired := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	expired := time.Now().Add(-48 * time.Hour).Format(time.RFC3339)
+	ring := loadTestRing(t, `{
+		"active": "ed-2",
+		"keys": [
+			{"kid": "ed-2", "alg": "EdDSA", "private_key": "ed.pem"},
+			{"kid": "ec-1", "alg": "ES256", "private_key": "ec.pem", "retired_at": "`+retired+`"},
+			{"kid": "hs-0", "alg": "HS256", "secret": "`+testSecret+`", "retired_at": "`+expired+`"}
+		]
+	}`)
+
+	t.Run("active key signs with kid", func(t *testing.T) {
+		token, err := ring.Sign(claimsFor("user123"))
+		require.NoError(t, err)
+
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		require.NoError(t, err)
+		assert.Equal(t, "ed-2", parsed.Header["kid"])
+		assert.Equal(t, "EdDSA", parsed.Header["alg"])
+
+		claims, err := ring.Parse(token)
+		require.NoError(t, err)
+		assert.Equal(t, "user123", claims["sub"])
+	})
+
+	t.Run("retired key within grace period", func(t *testing.T) {
+		key := ring.keys["ec-1"]
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claimsFor("user123"))
+		token.Header["kid"] = "ec-1"
+		signed, err := token.SignedString(key.sign)
+		require.NoError(t, err)
+
+		_, err = ring.Parse(signed)
+		assert.NoError(t, err)
+	})
+
+	t.Run("retired key after grace period", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claimsFor("user123"))
+		token.Header["kid"] = "hs-0"
+		signed, err := token.SignedString(ring.keys["hs-0"].sign)
+		require.NoError(t, err)
+
+		_, err = ring.Parse(signed)
+		assert.Error(t, err)
+	})
+
+	t.Run("legacy token without kid", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claimsFor("user123"))
+		signed, err := token.SignedString(ring.keys[legacyKeyID].sign)
+		require.NoError(t, err)
+
+		_, err = ring.Parse(signed)
+		assert.NoError(t, err)
+	})
+
+	t.Run("algorithm is pinned per kid", func(t *testing.T) {
+		// HS256 token claiming to come from the EdDSA key
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claimsFor("user123"))
+		token.Header["kid"] = "ed-2"
+		signed, err := token.SignedString(ring.keys[legacyKeyID].sign)
+		require.NoError(t, err)
+
+		_, err = ring.Parse(signed)
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown kid", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claimsFor("user123"))
+		token.Header["kid"] = "nope"
+		signed, err := token.SignedString(ring.keys[legacyKeyID].sign)
+		require.NoError(t, err)
+
+		_, err = ring.Parse(signed)
+		assert.Error(t, err)
+	})
+
+	t.Run("jwks publishes only usable public keys", func(t *testing.T) {
+		keys := ring.JWKS()
+		require.Len(t, keys, 2)
+		assert.Equal(t, "ec-1", keys[0]["kid"])
+		assert.Equal(t, "EC", keys[0]["kty"])
+		assert.Len(t, keys[0]["x"], 43)
+		assert.Equal(t, "ed-2", keys[1]["kid"])
+		assert.Equal(t, "OKP", keys[1]["kty"])
+		assert.Equal(t, "Ed25519", keys[1]["crv"])
+	})
+}
+
+func TestKeyRingConfiguration(t *testing.T) {
+	t.Run("secret only", func(t *testing.T) {
+		t.Setenv("JWT_SECRET", testSecret)
+		t.Setenv("JWT_KEYS_FILE", "")
+		ring, err := LoadKeyRing()
+		require.NoError(t, err)
+		assert.Equal(t, legacyKeyID, ring.active.ID)
+		assert.Empty(t, ring.JWKS())
+	})
+
+	t.Run("short secret", func(t *testing.T) {
+		t.Setenv("JWT_SECRET", "c2hvcnQ")
+		t.Setenv("JWT_KEYS_FILE", "")
+		_, err := LoadKeyRing()
+		assert.Error(t, err)
+	})
+
+	t.Run("mismatched key type", func(t *testing.T) {
+		dir := t.TempDir()
+		_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+		writePrivateKey(t, dir, "ed.pem", edKey)
+		path := filepath.Join(dir, "keys.json")
+		os.WriteFile(path, []byte(`{"active": "k", "keys": [{"kid": "k", "alg": "ES256", "private_key": "ed.pem"}]}`), 0600)
+
+		t.Setenv("JWT_SECRET", "")
+		t.Setenv("JWT_KEYS_FILE", path)
+		_, err := LoadKeyRing()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"errors"
+	"halves/pkg/model"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Minimum pause between two login links for the same user
+const magicLinkResendInterval = time.Minute
+
+var errMagicLinkDevice = errors.New("login link belongs to another device")
+
+const deviceRequired = "X-Device-ID header required"
+
+func magicLinkTTL() time.Duration {
+	return envDuration("MAGIC_LINK_TTL", 10*time.Minute)
+}
+
+// The data of a login link is the device that asked for it and the address
+// it was sent to; headers can't hold a newline, so it separates them
+func magicLinkData(deviceID, email string) string {
+	return deviceID + "\n" + email
+}
+
+func parseMagicLinkData(data string) (deviceID, email string) {
+	deviceID, email, _ = strings.Cut(data, "\n")
+	return deviceID, email
+}
+
+// RequestMagicLink emails a single-use login link. The link only works on the
+// device that asked for it (X-Device-ID).
+func (s *AuthService) RequestMagicLink(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Without a device the link could be used anywhere
+	deviceID := c.GetHeader("X-Device-ID")
+	if deviceID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": deviceRequired})
+		return
+	}
+
+	// Same answer whether or not the email exists or was rate limited
+	const sent = "login link sent if email exists"
+
+	var user model.User
+	if result := s.db.Where("LOWER(email) = ?", normalizeEmail(req.Email)).First(&user); result.Error != nil {
+		c.JSON(http.StatusOK, gin.H{"status": sent})
+		return
+	}
+
+	var last model.ActionToken
+	if err := s.db.Where("user_id = ? AND purpose = ?", user.ID, purposeMagicLogin).
+		Order("created_at desc").First(&last).Error; err == nil &&
+		last.CreatedAt > time.Now().Add(-magicLinkResendInterval).Unix() {
+		c.JSON(http.StatusOK, gin.H{"status": sent})
+		return
+	}
+
+	ttl := magicLinkTTL()
+	token, err := createActionToken(s.db, user.ID, purposeMagicLogin, magicLinkData(deviceID, user.Email), ttl)
+	if err != nil {
+		log.Printf("Failed to create login link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create login link"})
+		return
+	}
+
+	s.sendMail(user.Email, "magic", map[string]string{
+		"TOKEN":      token,
+		"LOGIN_URL":  actionURL("MAGIC_LINK_URL", token),
+		"EXPIRES_IN": strconv.Itoa(int(ttl.Minutes())),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"status": sent})
+}
+
+// ConfirmMagicLink redeems a login link and answers like /login
+func (s *AuthService) ConfirmMagicLink(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	deviceID := c.GetHeader("X-Device-ID")
+	if deviceID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": deviceRequired})
+		return
+	}
+
+	var user model.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Check the device before burning the token, so that a link opened
+		// on the wrong device still works on the right one
+		var pending model.ActionToken
+		if err := tx.Where("token_hash = ? AND purpose = ?", hashToken(req.Token), purposeMagicLogin).
+			First(&pending).Error; err != nil {
+			return errActionTokenInvalid
+		}
+		linkDevice, sentTo := parseMagicLinkData(pending.Data)
+		if linkDevice != deviceID {
+			return errMagicLinkDevice
+		}
+
+		token, err := consumeActionToken(tx, req.Token, purposeMagicLogin)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", token.UserID).First(&user).Error; err != nil {
+			return errActionTokenInvalid
+		}
+		// Following the link proves the address it was sent to, unless the
+		// user changed it since
+		if user.EmailVerified || user.Email != sentTo {
+			return nil
+		}
+		result := tx.Model(&model.User{}).
+			Where("id = ? AND email = ?", user.ID, sentTo).
+			Update("email_verified", true)
+		user.EmailVerified = result.RowsAffected == 1
+		return result.Error
+	})
+	if errors.Is(err, errMagicLinkDevice) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "open the login link on the device that requested it"})
+		return
+	}
+	if errors.Is(err, errActionTokenInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log in"})
+		return
+	}
+
+	s.finishLogin(c, &user, deviceID, "magic_link")
+}
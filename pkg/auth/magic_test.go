@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"halves/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmMagicLink(t *testing.T) {
+	s := newTestAuthService(t)
+	require.NoError(t, s.db.AutoMigrate(&model.LoginThrottle{}, &model.AuditLog{}))
+	r := gin.New()
+	r.POST("/login/magic/confirm", s.ConfirmMagicLink)
+	confirm := func(token, deviceID string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/login/magic/confirm", strings.NewReader(`{"token":"`+token+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Device-ID", deviceID)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	newUser := func(id, email string) {
+		require.NoError(t, s.db.Create(&model.User{ID: id, Email: email, CreatedAt: time.Now().Unix()}).Error)
+	}
+	verified := func(id string) bool {
+		var user model.User
+		require.NoError(t, s.db.First(&user, "id = ?", id).Error)
+		return user.EmailVerified
+	}
+
+	newUser("user-1", "a@example.com")
+	token, err := createActionToken(s.db, "user-1", purposeMagicLogin, magicLinkData("dev-1", "a@example.com"), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, confirm(token, "dev-2"))
+	assert.Equal(t, http.StatusOK, confirm(token, "dev-1"), "the wrong device doesn't use up the link")
+	assert.True(t, verified("user-1"))
+	assert.Equal(t, http.StatusUnauthorized, confirm(token, "dev-1"))
+
+	// the address changed after the link was sent: log in, but don't verify
+	newUser("user-2", "b@example.com")
+	token, err = createActionToken(s.db, "user-2", purposeMagicLogin, magicLinkData("dev-1", "b@example.com"), time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, s.db.Model(&model.User{}).Where("id = ?", "user-2").Update("email", "c@example.com").Error)
+	assert.Equal(t, http.StatusOK, confirm(token, "dev-1"))
+	assert.False(t, verified("user-2"))
+}
@@ -2,8 +2,6 @@
 package auth
 
 import (
-	"encoding/base64"
-	"fmt"
 	"halves/pkg/model"
 	"net/http"
 	"os"
@@ -11,15 +9,16 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 )
 
 func JWTMiddleware() gin.HandlerFunc {
-	secretString := os.Getenv("JWT_SECRET")
 	return func(c *gin.Context) {
-		// 1. Get Authorization header
+		// 1. Get Authorization header; bots may send X-API-Key instead
 		tokenString := c.GetHeader("Authorization")
+		if tokenString == "" {
+			tokenString = c.GetHeader("X-API-Key")
+		}
 		if tokenString == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "Authorization header required",
@@ -32,50 +31,69 @@ func JWTMiddleware() gin.HandlerFunc {
 			tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 		}
 
-		// 3. Decode JWT secret
-		secret, err := base64.RawStdEncoding.DecodeString(secretString)
-		if err != nil || len(secret) < 32 {
+		// API keys are opaque and checked against the database
+		if strings.HasPrefix(tokenString, apiKeyPrefix) {
+			authenticateAPIKey(c, tokenString)
+			return
+		}
+
+		// 3. Load signing keys
+		ring, err := currentKeyRing()
+		if err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 				"error": "Server configuration error",
 			})
 			return
 		}
 
-		// 4. Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate algorithm
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return secret, nil
-		})
+		// 4. Parse and validate token; the kid header picks the key and
+		// each key only accepts its own algorithm
+		claims, err := ring.Parse(tokenString)
 
 		// 5. Handle parsing errors
-		if err != nil || !token.Valid {
+		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid or expired token",
 			})
 			return
 		}
 
-		// 6. Validate claims
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			// Check expiration
-			if exp, ok := claims["exp"].(float64); ok {
-				if time.Now().Unix() > int64(exp) {
-					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-						"error": "Token expired",
-					})
-					return
-				}
+		// 6. Validate claims, starting with expiration
+		if exp, ok := claims["exp"].(float64); ok {
+			if time.Now().Unix() > int64(exp) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": "Token expired",
+				})
+				return
 			}
+		}
 
-			// Set user ID in context
-			if sub, ok := claims["sub"].(string); ok {
-				c.Set("userID", sub)
-				c.Next()
-				return
+		// Typed tokens (2FA challenge, ...) are not API credentials
+		if typ, _ := claims["typ"].(string); typ != "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid token type",
+			})
+			return
+		}
+
+		// Reject tokens revoked by logout
+		jti, _ := claims["jti"].(string)
+		if jti != "" && revoked.contains(jti) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Token revoked",
+			})
+			return
+		}
+
+		// Set user ID in context
+		if sub, ok := claims["sub"].(string); ok {
+			c.Set("userID", sub)
+			c.Set("jti", jti)
+			if exp, ok := claims["exp"].(float64); ok {
+				c.Set("tokenExp", int64(exp))
 			}
+			c.Next()
+			return
 		}
 
 		// 7. Fallback error
@@ -95,16 +113,54 @@ func LastSeenUpdater() gin.HandlerFunc {
 				Where("id = ?", userID).
 				Update("last_seen", now)
 
-			// Update device status if available
+			// Online status is owned by the WebSocket handler
 			if deviceID := c.GetHeader("X-Device-ID"); deviceID != "" {
 				db.Model(&model.Device{}).
-					Where("id = ?", deviceID).
-					Updates(map[string]interface{}{
-						"last_seen": now,
-						"status":    "online",
-					})
+					Where("id = ? AND user_id = ?", deviceID, userID).
+					Update("last_seen", now)
 			}
 		}
 		c.Next()
 	}
 }
+
+// RequireVerifiedEmail blocks users who haven't confirmed their email address
+// yet. The policy is off unless REQUIRE_EMAIL_VERIFICATION=1.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	enabled := os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "1"
+	return func(c *gin.Context) {
+		if !enabled {
+			c.Next()
+			return
+		}
+
+		db := c.MustGet("db").(*gorm.DB)
+		var user model.User
+		if err := db.Select("email_verified").Where("id = ?", c.MustGet("userID")).First(&user).Error; err != nil || !user.EmailVerified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "email not verified",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole lets the request through only if the current user has at least
+// the given role. The role is read from the database on every request so
+// that a demotion takes effect immediately.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := c.MustGet("db").(*gorm.DB)
+		var user model.User
+		if err := db.Select("role").Where("id = ?", c.MustGet("userID")).First(&user).Error; err != nil ||
+			model.RoleRank(user.Role) < model.RoleRank(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "insufficient role",
+			})
+			return
+		}
+		c.Set("role", user.Role)
+		c.Next()
+	}
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"errors"
+	"halves/pkg/model"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errOIDCStateInvalid = errors.New("invalid or expired state")
+	errOIDCNoEmail      = errors.New("provider returned no email")
+	errOIDCEmailTaken   = errors.New("email already registered")
+)
+
+func oidcStateTTL() time.Duration {
+	return envDuration("OIDC_STATE_TTL", 10*time.Minute)
+}
+
+func (s *AuthService) oidcProvider(c *gin.Context) *oidcProvider {
+	p, ok := s.oidc[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown provider"})
+		return nil
+	}
+	return p
+}
+
+// OIDCLogin starts sign-in with an external provider. Browsers are redirected
+// to the provider; clients asking for JSON get the URL to open instead.
+// Browsers can't set X-Device-ID, so the device may also be passed as
+// ?device_id=.
+func (s *AuthService) OIDCLogin(c *gin.Context) {
+	p := s.oidcProvider(c)
+	if p == nil {
+		return
+	}
+
+	deviceID := c.GetHeader("X-Device-ID")
+	if deviceID == "" {
+		deviceID = c.Query("device_id")
+	}
+
+	state, stateHash, err := newOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start sign-in"})
+		return
+	}
+	nonce, _, err := newOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start sign-in"})
+		return
+	}
+	verifier, _, err := newOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start sign-in"})
+		return
+	}
+
+	authURL, err := p.authorizationURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("OIDC %s: %v", p.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
+
+	now := time.Now()
+	if err := s.db.Create(&model.OIDCState{
+		StateHash:    stateHash,
+		Provider:     p.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		DeviceID:     deviceID,
+		CreatedAt:    now.Unix(),
+		ExpiresAt:    now.Add(oidcStateTTL()).Unix(),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start sign-in"})
+		return
+	}
+
+	if strings.Contains(c.GetHeader("Accept"), "application/json") {
+		c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback finishes sign-in: it redeems the code, validates the ID token,
+// links or creates the user and answers like /login. The provider may call it
+// with a GET (query) or a form POST (response_mode=form_post); apps that
+// catch the redirect themselves can POST the code and state as JSON.
+func (s *AuthService) OIDCCallback(c *gin.Context) {
+	p := s.oidcProvider(c)
+	if p == nil {
+		return
+	}
+
+	var req struct {
+		Code             string `form:"code" json:"code"`
+		State            string `form:"state" json:"state"`
+		Error            string `form:"error" json:"error"`
+		ErrorDescription string `form:"error_description" json:"error_description"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Error != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "sign-in cancelled: " + req.Error})
+		return
+	}
+	if req.Code == "" || req.State == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and state are required"})
+		return
+	}
+
+	state, err := s.consumeOIDCState(p.Name, req.State)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired state"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	rawIDToken, err := p.exchange(ctx, req.Code, state.CodeVerifier)
+	if err != nil {
+		log.Printf("OIDC %s: %v", p.Name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "sign-in failed"})
+		return
+	}
+	identity, err := p.verifyIDToken(ctx, rawIDToken, state.Nonce)
+	if err != nil {
+		log.Printf("OIDC %s: %v", p.Name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "sign-in failed"})
+		return
+	}
+
+	user, err := s.userForIdentity(c, p.Name, identity)
+	switch {
+	case errors.Is(err, errOIDCNoEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "identity provider didn't share an email address"})
+		return
+	case errors.Is(err, errOIDCEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "an account with this email already exists, log in with your password"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign in"})
+		return
+	}
+
+	s.finishLogin(c, user, state.DeviceID, "oidc:"+p.Name)
+}
+
+// consumeOIDCState marks the state as used and returns it, so that a
+// callback can't be replayed
+func (s *AuthService) consumeOIDCState(provider, state string) (*model.OIDCState, error) {
+	var row model.OIDCState
+	if err := s.db.Where("state_hash = ? AND provider = ?", hashToken(state), provider).
+		First(&row).Error; err != nil {
+		return nil, errOIDCStateInvalid
+	}
+	now := time.Now().Unix()
+	if row.UsedAt != 0 || row.ExpiresAt < now {
+		return nil, errOIDCStateInvalid
+	}
+	result := s.db.Model(&model.OIDCState{}).
+		Where("state_hash = ? AND used_at = 0", row.StateHash).
+		Update("used_at", now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, errOIDCStateInvalid
+	}
+	return &row, nil
+}
+
+// userForIdentity returns the user linked to the external account. Unknown
+// accounts are linked to the user with the same email only if the provider
+// verified that email; otherwise a new user is created.
+func (s *AuthService) userForIdentity(c *gin.Context, provider string, identity *oidcIdentity) (*model.User, error) {
+	var user model.User
+	var linked bool
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var link model.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, identity.Subject).First(&link).Error
+		if err == nil {
+			return tx.Where("id = ?", link.UserID).First(&user).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if identity.Email == "" {
+			return errOIDCNoEmail
+		}
+		now := time.Now().Unix()
+		err = tx.Where("LOWER(email) = ?", normalizeEmail(identity.Email)).First(&user).Error
+		switch {
+		case err == nil:
+			if !identity.EmailVerified {
+				return errOIDCEmailTaken
+			}
+			if !user.EmailVerified {
+				if err := tx.Model(&user).Update("email_verified", true).Error; err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			user = model.User{
+				ID:            generateUUID(),
+				Email:         identity.Email,
+				CreatedAt:     now,
+				EmailVerified: identity.EmailVerified,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		linked = true
+		return tx.Create(&model.UserIdentity{
+			ID:        generateUUID(),
+			UserID:    user.ID,
+			Provider:  provider,
+			Subject:   identity.Subject,
+			Email:     identity.Email,
+			CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		if !errors.Is(err, errOIDCNoEmail) && !errors.Is(err, errOIDCEmailTaken) {
+			log.Printf("OIDC %s: failed to resolve user: %v", provider, err)
+		}
+		return nil, err
+	}
+
+	if linked {
+		s.audit(c, user.ID, auditIdentityLinked, provider)
+	}
+	return &user, nil
+}
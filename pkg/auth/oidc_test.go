@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"halves/pkg/model"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// mockIdP is a minimal OpenID Connect provider: discovery, JWKS and a token
+// endpoint that checks PKCE. Codes are handed out with authorize.
+type mockIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp := &mockIdP{key: key, codes: make(map[string]mockGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                           idp.URL,
+			"authorization_endpoint":           idp.URL + "/authorize",
+			"token_endpoint":                   idp.URL + "/token",
+			"jwks_uri":                         idp.URL + "/jwks",
+			"code_challenge_methods_supported": []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		grant, ok := idp.codes[r.Form.Get("code")]
+		delete(idp.codes, r.Form.Get("code"))
+		idp.mu.Unlock()
+		if !ok || pkceChallenge(r.Form.Get("code_verifier")) != grant.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t, grant.claims)})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *mockIdP) sign(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(idp.key)
+	require.NoError(t, err)
+	return signed
+}
+
+// authorize plays the user logging in at the provider: it issues a code for
+// the authorization URL our server redirected to
+func (idp *mockIdP) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (code, state string) {
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	q := u.Query()
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+
+	base := jwt.MapClaims{
+		"iss":   idp.URL,
+		"aud":   "client-1",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		base[k] = v
+	}
+	code = generateUUID()
+	idp.mu.Lock()
+	idp.codes[code] = mockGrant{challenge: q.Get("code_challenge"), claims: base}
+	idp.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("JWT_KEYS_FILE", "")
+	ring, err := LoadKeyRing()
+	require.NoError(t, err)
+	SetKeyRing(ring)
+	defer SetKeyRing(nil)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Device{}, &model.RefreshToken{},
+		&model.AuditLog{}, &model.LoginThrottle{}, &model.UserIdentity{}, &model.OIDCState{}))
+
+	idp := newMockIdP(t)
+	s := &AuthService{db: db, oidc: map[string]*oidcProvider{"mock": {
+		Name:        "mock",
+		Issuer:      idp.URL,
+		ClientID:    "client-1",
+		RedirectURL: "http://localhost/oidc/mock/callback",
+		Scopes:      []string{"openid", "email"},
+		client:      idp.Client(),
+	}}}
+	r := gin.New()
+	r.GET("/oidc/:provider/login", s.OIDCLogin)
+	r.GET("/oidc/:provider/callback", s.OIDCCallback)
+
+	start := func() string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/oidc/mock/login", nil)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("X-Device-ID", "dev-1")
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var body struct {
+			AuthorizationURL string `json:"authorization_url"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.AuthorizationURL
+	}
+	callback := func(code, state string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		q := url.Values{"code": {code}, "state": {state}}
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oidc/mock/callback?"+q.Encode(), nil))
+		return w
+	}
+	login := func(claims jwt.MapClaims) *httptest.ResponseRecorder {
+		return callback(idp.authorize(t, start(), claims))
+	}
+	userID := func(w *httptest.ResponseRecorder) string {
+		var body struct {
+			UUID string `json:"uuid"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return body.UUID
+	}
+
+	t.Run("new user is created and linked", func(t *testing.T) {
+		w := login(jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "email_verified": true})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		id := userID(w)
+		assert.NotEmpty(t, id)
+
+		var token model.RefreshToken
+		require.NoError(t, db.Where("user_id = ?", id).First(&token).Error)
+		assert.Equal(t, "dev-1", token.DeviceID)
+
+		// Next sign-in finds the same user through the identity link
+		w = login(jwt.MapClaims{"sub": "alice", "email": "alice@new.example.com"})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, id, userID(w))
+	})
+
+	t.Run("verified email links existing user", func(t *testing.T) {
+		require.NoError(t, db.Create(&model.User{ID: generateUUID(), Email: "bob@example.com", CreatedAt: 1}).Error)
+
+		w := login(jwt.MapClaims{"sub": "bob-unverified", "email": "bob@example.com", "email_verified": "false"})
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = login(jwt.MapClaims{"sub": "bob", "email": "Bob@example.com", "email_verified": "true"})
+		require.Equal(t, http.StatusOK, w.Code)
+		var user model.User
+		require.NoError(t, db.Where("email = ?", "bob@example.com").First(&user).Error)
+		assert.Equal(t, user.ID, userID(w))
+		assert.True(t, user.EmailVerified)
+	})
+
+	t.Run("state is single use", func(t *testing.T) {
+		code, state := idp.authorize(t, start(), jwt.MapClaims{"sub": "alice"})
+		require.Equal(t, http.StatusOK, callback(code, state).Code)
+		assert.Equal(t, http.StatusUnauthorized, callback(code, state).Code)
+		assert.Equal(t, http.StatusUnauthorized, callback(code, "forged").Code)
+	})
+
+	t.Run("id token checks", func(t *testing.T) {
+		for name, claims := range map[string]jwt.MapClaims{
+			"wrong nonce":    {"sub": "alice", "nonce": "other"},
+			"wrong audience": {"sub": "alice", "aud": "client-2"},
+			"wrong issuer":   {"sub": "alice", "iss": "https://evil.example.com"},
+			"expired":        {"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()},
+			"foreign azp":    {"sub": "alice", "aud": []string{"client-1", "client-2"}, "azp": "client-2"},
+		} {
+			assert.Equal(t, http.StatusUnauthorized, login(claims).Code, name)
+		}
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oidc/nope/login", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashes are stored in a self-describing format so the algorithm and
+// its parameters can change without a schema change:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>   (PHC string format)
+//	$2a$12$<salt+hash>                             (bcrypt modular crypt format)
+//
+// Rows created before that hold a 2-character salt followed by a hex SHA-256;
+// they are still accepted and rehashed on the next successful login.
+
+const (
+	algArgon2id = "argon2id"
+	algBcrypt   = "bcrypt"
+)
+
+// argon2Params are the argon2id cost parameters
+type argon2Params struct {
+	Memory  uint32 // KiB
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// OWASP baseline; kept small because the container is limited to 120M
+var defaultArgon2Params = argon2Params{
+	Memory:  19 * 1024,
+	Time:    2,
+	Threads: 1,
+	SaltLen: 16,
+	KeyLen:  32,
+}
+
+const defaultBcryptCost = 12
+
+// passwordAlgorithm returns the algorithm new hashes are created with,
+// configured by PASSWORD_HASH (argon2id by default)
+func passwordAlgorithm() string {
+	if strings.EqualFold(os.Getenv("PASSWORD_HASH"), algBcrypt) {
+		return algBcrypt
+	}
+	return algArgon2id
+}
+
+// hashPassword hashes a password with the configured algorithm
+func hashPassword(password string) (string, error) {
+	if passwordAlgorithm() == algBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), defaultBcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash password: %w", err)
+		}
+		return string(hash), nil
+	}
+	return hashArgon2id(password, defaultArgon2Params)
+}
+
+func hashArgon2id(password string, p argon2Params) (string, error) {
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	hash := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// verifyPassword checks a password against any supported stored format. The
+// second result reports whether the hash should be replaced because it uses a
+// legacy format, another algorithm or weaker parameters than the current ones.
+func verifyPassword(password, encoded string) (bool, bool) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		p, salt, hash, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, false
+		}
+		computed := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, uint32(len(hash)))
+		if subtle.ConstantTimeCompare(hash, computed) != 1 {
+			return false, false
+		}
+		d := defaultArgon2Params
+		weaker := p.Memory < d.Memory || p.Time < d.Time || p.Threads < d.Threads
+		return true, weaker || passwordAlgorithm() != algArgon2id
+
+	case strings.HasPrefix(encoded, "$2"):
+		if bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) != nil {
+			return false, false
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return true, err != nil || cost < defaultBcryptCost || passwordAlgorithm() != algBcrypt
+
+	default:
+		return checkLegacyPassword(password, encoded), true
+	}
+}
+
+func decodeArgon2id(encoded string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	if p.Time == 0 || p.Threads == 0 {
+		return p, nil, nil, fmt.Errorf("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(hash) == 0 {
+		return p, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+	p.SaltLen, p.KeyLen = uint32(len(salt)), uint32(len(hash))
+	return p, salt, hash, nil
+}
+
+// checkLegacyPassword verifies the old "<2-char salt><hex sha256>" format
+func checkLegacyPassword(password, encoded string) bool {
+	if len(encoded) != 2+sha256.Size*2 {
+		return false
+	}
+	// Extract the salt (first 2 characters) and the hash
+	salt := encoded[:2]
+	storedHash, err := hex.DecodeString(encoded[2:])
+	if err != nil {
+		return false
+	}
+
+	newHash := sha256.Sum256(append([]byte(password), []byte(salt)...))
+	return subtle.ConstantTimeCompare(storedHash, newHash[:]) == 1
+}
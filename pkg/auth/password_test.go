@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHashing(t *testing.T) {
+	t.Run("argon2id round trip", func(t *testing.T) {
+		hash, err := hashPassword("securepassword123")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"))
+
+		ok, rehash := verifyPassword("securepassword123", hash)
+		assert.True(t, ok)
+		assert.False(t, rehash)
+
+		ok, _ = verifyPassword("wrongpassword", hash)
+		assert.False(t, ok)
+	})
+
+	t.Run("salts differ", func(t *testing.T) {
+		a, _ := hashPassword("securepassword123")
+		b, _ := hashPassword("securepassword123")
+		assert.NotEqual(t, a, b)
+	})
+
+	t.Run("bcrypt when configured", func(t *testing.T) {
+		os.Setenv("PASSWORD_HASH", "bcrypt")
+		defer os.Unsetenv("PASSWORD_HASH")
+
+		hash, err := hashPassword("securepassword123")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(hash, "$2a$12$"))
+
+		ok, rehash := verifyPassword("securepassword123", hash)
+		assert.True(t, ok)
+		assert.False(t, rehash)
+	})
+
+	t.Run("other algorithm needs rehash", func(t *testing.T) {
+		hash, err := bcrypt.GenerateFromPassword([]byte("securepassword123"), bcrypt.MinCost)
+		require.NoError(t, err)
+
+		ok, rehash := verifyPassword("securepassword123", string(hash))
+		assert.True(t, ok)
+		assert.True(t, rehash)
+	})
+
+	t.Run("weaker argon2 parameters need rehash", func(t *testing.T) {
+		weak := defaultArgon2Params
+		weak.Time = 1
+		weak.Memory = 8 * 1024
+		hash, err := hashArgon2id("securepassword123", weak)
+		require.NoError(t, err)
+
+		ok, rehash := verifyPassword("securepassword123", hash)
+		assert.True(t, ok)
+		assert.True(t, rehash)
+	})
+
+	t.Run("legacy sha256 is accepted and flagged", func(t *testing.T) {
+		sum := sha256.Sum256([]byte("securepassword123" + "aB"))
+		legacy := fmt.Sprintf("aB%x", sum)
+
+		ok, rehash := verifyPassword("securepassword123", legacy)
+		assert.True(t, ok)
+		assert.True(t, rehash)
+
+		ok, _ = verifyPassword("wrongpassword", legacy)
+		assert.False(t, ok)
+	})
+
+	t.Run("malformed hashes are rejected", func(t *testing.T) {
+		for _, encoded := range []string{"", "x", "$argon2id$v=19$m=1$abc", "$argon2id$v=18$m=65536,t=3,p=2$c2FsdA$aGFzaA"} {
+			ok, _ := verifyPassword("securepassword123", encoded)
+			assert.False(t, ok, encoded)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"halves/pkg/model"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SessionCloser drops live connections of a user whose tokens were revoked
+type SessionCloser interface {
+	DisconnectUser(userID string)
+	DisconnectDevice(userID, deviceID string)
+}
+
+// revocationList mirrors the revoked_tokens table in memory so that
+// JWTMiddleware doesn't hit SQLite on every request
+type revocationList struct {
+	mu   sync.RWMutex
+	jtis map[string]int64 // jti -> expiry
+}
+
+var revoked = &revocationList{jtis: make(map[string]int64)}
+
+// load replaces the cache with every still relevant row from the database
+func (r *revocationList) load(db *gorm.DB) error {
+	var rows []model.RevokedToken
+	if err := db.Where("expires_at > ?", time.Now().Unix()).Find(&rows).Error; err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jtis = make(map[string]int64, len(rows))
+	for _, row := range rows {
+		r.jtis[row.JTI] = row.ExpiresAt
+	}
+	return nil
+}
+
+func (r *revocationList) add(jti string, exp int64) {
+	r.mu.Lock()
+	r.jtis[jti] = exp
+	r.mu.Unlock()
+}
+
+func (r *revocationList) contains(jti string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.jtis[jti]
+	return ok
+}
+
+// prune forgets entries that expired on their own
+func (r *revocationList) prune() {
+	now := time.Now().Unix()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for jti, exp := range r.jtis {
+		if exp < now {
+			delete(r.jtis, jti)
+		}
+	}
+}
+
+// revokeAccessToken persists the jti and adds it to the cache
+func revokeAccessToken(db *gorm.DB, userID, jti string, exp int64) error {
+	if jti == "" || exp < time.Now().Unix() {
+		return nil
+	}
+	row := model.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: exp,
+		RevokedAt: time.Now().Unix(),
+	}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+		return err
+	}
+	revoked.add(jti, exp)
+	return nil
+}
+
+// revokeRefreshTokens revokes the matching refresh tokens together with the
+// access tokens that were issued alongside them
+func revokeRefreshTokens(db *gorm.DB, query string, args ...interface{}) error {
+	var rows []model.RefreshToken
+	if err := db.Where("revoked_at = 0").Where(query, args...).Find(&rows).Error; err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for _, row := range rows {
+		if err := revokeAccessToken(db, row.UserID, row.AccessJTI, row.AccessExpiresAt); err != nil {
+			return err
+		}
+	}
+	return db.Model(&model.RefreshToken{}).
+		Where("revoked_at = 0").
+		Where(query, args...).
+		Update("revoked_at", now).Error
+}
+
+// RevokeUserSessions logs the user out everywhere
+func (s *AuthService) RevokeUserSessions(userID string) error {
+	if err := revokeRefreshTokens(s.db, "user_id = ?", userID); err != nil {
+		return err
+	}
+	if s.sessions != nil {
+		s.sessions.DisconnectUser(userID)
+	}
+	return nil
+}
+
+// PruneRevocations drops expired entries from the revocation list
+func (s *AuthService) PruneRevocations() {
+	if err := s.db.Where("expires_at < ?", time.Now().Unix()).
+		Delete(&model.RevokedToken{}).Error; err != nil {
+		log.Println("Failed to prune revoked tokens:", err)
+	}
+	revoked.prune()
+}
+
+// Logout revokes the presented access token and the refresh chain it came from
+func (s *AuthService) Logout(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+	jti := c.GetString("jti")
+	exp := c.GetInt64("tokenExp")
+
+	if err := revokeAccessToken(s.db, userID, jti, exp); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+		return
+	}
+
+	if jti != "" {
+		var current model.RefreshToken
+		if err := s.db.Where("access_jti = ? AND user_id = ?", jti, userID).First(&current).Error; err == nil {
+			if err := revokeRefreshTokens(s.db, "family_id = ?", current.FamilyID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+				return
+			}
+		}
+	}
+
+	if s.sessions != nil {
+		s.sessions.DisconnectUser(userID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "logged out"})
+}
+
+// LogoutAll revokes every token of the current user
+func (s *AuthService) LogoutAll(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	if err := revokeAccessToken(s.db, userID, c.GetString("jti"), c.GetInt64("tokenExp")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+		return
+	}
+	if err := s.RevokeUserSessions(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "logged out everywhere"})
+}
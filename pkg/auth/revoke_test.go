@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"halves/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevocationList(t *testing.T) {
+	s := newTestAuthService(t)
+	now := time.Now().Unix()
+
+	require.NoError(t, revokeAccessToken(s.db, "user-1", "live", now+60))
+	require.NoError(t, revokeAccessToken(s.db, "user-1", "live", now+60), "revoking twice is fine")
+	require.NoError(t, revokeAccessToken(s.db, "user-1", "expired", now-60))
+	assert.True(t, revoked.contains("live"))
+	assert.False(t, revoked.contains("expired"), "expired tokens are rejected anyway")
+
+	var rows int64
+	require.NoError(t, s.db.Model(&model.RevokedToken{}).Count(&rows).Error)
+	assert.EqualValues(t, 1, rows)
+
+	// a restart rebuilds the cache from the table, without expired rows
+	require.NoError(t, s.db.Create(&model.RevokedToken{JTI: "old", UserID: "user-1", ExpiresAt: now - 1, RevokedAt: now - 60}).Error)
+	revoked = &revocationList{jtis: make(map[string]int64)}
+	require.NoError(t, revoked.load(s.db))
+	assert.True(t, revoked.contains("live"))
+	assert.False(t, revoked.contains("old"))
+
+	// pruning forgets what expired on its own
+	revoked.add("old", now-1)
+	s.PruneRevocations()
+	assert.False(t, revoked.contains("old"))
+	assert.True(t, revoked.contains("live"))
+	require.NoError(t, s.db.Model(&model.RevokedToken{}).Count(&rows).Error)
+	assert.EqualValues(t, 1, rows)
+}
+
+func newLogoutRouter(s *AuthService) *gin.Engine {
+	r := gin.New()
+	r.POST("/token/refresh", s.RefreshToken)
+	r.POST("/logout", JWTMiddleware(), s.Logout)
+	r.POST("/logout/all", JWTMiddleware(), s.LogoutAll)
+	r.GET("/me", JWTMiddleware(), func(c *gin.Context) { c.String(http.StatusOK, c.GetString("userID")) })
+	return r
+}
+
+func authorizedRequest(r *gin.Engine, method, path, accessToken string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLogout(t *testing.T) {
+	s := newTestAuthService(t)
+	r := newLogoutRouter(s)
+	phone := issueTestTokens(t, s, "dev-1")
+	laptop := issueTestTokens(t, s, "dev-2")
+
+	assert.Equal(t, http.StatusOK, authorizedRequest(r, http.MethodGet, "/me", phone.AccessToken).Code)
+	assert.Equal(t, http.StatusOK, authorizedRequest(r, http.MethodPost, "/logout", phone.AccessToken).Code)
+
+	w := authorizedRequest(r, http.MethodGet, "/me", phone.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Token revoked")
+	assert.Equal(t, http.StatusUnauthorized, refreshRequest(r, phone.RefreshToken, "dev-1").Code)
+
+	// only the session that logged out ends
+	assert.Equal(t, http.StatusOK, authorizedRequest(r, http.MethodGet, "/me", laptop.AccessToken).Code)
+	assert.Equal(t, http.StatusOK, refreshRequest(r, laptop.RefreshToken, "dev-2").Code)
+}
+
+func TestLogoutAll(t *testing.T) {
+	s := newTestAuthService(t)
+	r := newLogoutRouter(s)
+	phone := issueTestTokens(t, s, "dev-1")
+	laptop := issueTestTokens(t, s, "dev-2")
+	stranger, err := s.issueTokens(s.db, "user-2", "dev-3", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, authorizedRequest(r, http.MethodPost, "/logout/all", phone.AccessToken).Code)
+
+	for _, pair := range []*tokenPair{phone, laptop} {
+		assert.Equal(t, http.StatusUnauthorized, authorizedRequest(r, http.MethodGet, "/me", pair.AccessToken).Code)
+	}
+	assert.Equal(t, http.StatusUnauthorized, refreshRequest(r, phone.RefreshToken, "dev-1").Code)
+	assert.Equal(t, http.StatusUnauthorized, refreshRequest(r, laptop.RefreshToken, "dev-2").Code)
+
+	// other users stay signed in
+	assert.Equal(t, http.StatusOK, authorizedRequest(r, http.MethodGet, "/me", stranger.AccessToken).Code)
+	assert.Equal(t, http.StatusOK, refreshRequest(r, stranger.RefreshToken, "dev-3").Code)
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"halves/pkg/model"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// touchDevice records the device a client logged in or refreshed from, so
+// that it shows up in /sessions even before it opens a WebSocket
+func (s *AuthService) touchDevice(c *gin.Context, userID, deviceID string) {
+	if deviceID == "" {
+		return
+	}
+	now := time.Now().Unix()
+	// a device id already taken by another user is left alone, so nobody can
+	// take over someone else's session entry
+	err := s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"last_seen":  now,
+			"user_agent": c.GetHeader("User-Agent"),
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "devices.user_id = excluded.user_id"}}},
+	}).Create(&model.Device{
+		ID:        deviceID,
+		UserID:    userID,
+		LastSeen:  now,
+		Status:    "F",
+		UserAgent: c.GetHeader("User-Agent"),
+	}).Error
+	if err != nil {
+		log.Printf("Failed to record device %s: %v", deviceID, err)
+	}
+}
+
+// currentDeviceID returns the device the presented access token was issued to
+func (s *AuthService) currentDeviceID(c *gin.Context) string {
+	var current model.RefreshToken
+	if jti := c.GetString("jti"); jti != "" {
+		if err := s.db.Where("access_jti = ?", jti).First(&current).Error; err == nil && current.DeviceID != "" {
+			return current.DeviceID
+		}
+	}
+	return c.GetHeader("X-Device-ID")
+}
+
+// ListSessions returns the user's devices, most recently seen first
+func (s *AuthService) ListSessions(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	var devices []model.Device
+	if err := s.db.Where("user_id = ?", userID).
+		Order("last_seen DESC").
+		Find(&devices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get sessions"})
+		return
+	}
+
+	current := s.currentDeviceID(c)
+	sessions := make([]gin.H, 0, len(devices))
+	for _, d := range devices {
+		sessions = append(sessions, gin.H{
+			"device_id":  d.ID,
+			"user_agent": d.UserAgent,
+			"last_seen":  d.LastSeen,
+			"online":     d.Status == "O",
+			"current":    d.ID == current,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession logs a device out: its tokens are revoked, its WebSocket is
+// closed and the device is forgotten
+func (s *AuthService) RevokeSession(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+	deviceID := c.Param("deviceID")
+
+	var devices, tokens int64
+	s.db.Model(&model.Device{}).Where("id = ? AND user_id = ?", deviceID, userID).Count(&devices)
+	s.db.Model(&model.RefreshToken{}).
+		Where("device_id = ? AND user_id = ? AND revoked_at = 0", deviceID, userID).
+		Count(&tokens)
+	if devices == 0 && tokens == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	if err := revokeRefreshTokens(s.db, "device_id = ? AND user_id = ?", deviceID, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+	if err := s.db.Where("id = ? AND user_id = ?", deviceID, userID).
+		Delete(&model.Device{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+	if s.sessions != nil {
+		s.sessions.DisconnectDevice(userID, deviceID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "session revoked"})
+}
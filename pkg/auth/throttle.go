@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"halves/pkg/model"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Throttle scopes
+const (
+	scopeAccount = "account"
+	scopeIP      = "ip"
+)
+
+// throttlePolicy describes how failed logins slow down further attempts.
+// After freeAttempts failures every failure doubles the wait, starting at
+// baseDelay and capped at maxDelay. lockoutAfter failures lock the key for
+// lockoutFor. Failures older than window are forgotten.
+type throttlePolicy struct {
+	freeAttempts int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	lockoutAfter int
+	lockoutFor   time.Duration
+	window       time.Duration
+}
+
+func accountPolicy() throttlePolicy {
+	return throttlePolicy{
+		freeAttempts: 3,
+		baseDelay:    time.Second,
+		maxDelay:     5 * time.Minute,
+		lockoutAfter: envInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+		lockoutFor:   envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		window:       envDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+	}
+}
+
+// Many users can share an address, so the IP limits are looser
+func ipPolicy() throttlePolicy {
+	return throttlePolicy{
+		freeAttempts: 10,
+		baseDelay:    time.Second,
+		maxDelay:     5 * time.Minute,
+		lockoutAfter: envInt("LOGIN_IP_LOCKOUT_THRESHOLD", 100),
+		lockoutFor:   envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		window:       envDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+	}
+}
+
+// delay returns how long to block after the given number of failures and
+// whether that block is a lockout
+func (p throttlePolicy) delay(failures int) (time.Duration, bool) {
+	if failures >= p.lockoutAfter {
+		return p.lockoutFor, true
+	}
+	if failures <= p.freeAttempts {
+		return 0, false
+	}
+	shift := failures - p.freeAttempts - 1
+	if shift > 30 {
+		return p.maxDelay, false
+	}
+	d := p.baseDelay << shift
+	if d <= 0 || d > p.maxDelay {
+		d = p.maxDelay
+	}
+	return d, false
+}
+
+// throttleBlock is returned while a key may not try to log in
+type throttleBlock struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (b *throttleBlock) Error() string {
+	return fmt.Sprintf("login blocked for %s", b.RetryAfter)
+}
+
+// checkThrottle returns a *throttleBlock if any of the keys is still blocked
+func checkThrottle(db *gorm.DB, email, ip string, now time.Time) error {
+	var rows []model.LoginThrottle
+	if err := db.Where("(scope = ? AND key = ?) OR (scope = ? AND key = ?)",
+		scopeAccount, email, scopeIP, ip).Find(&rows).Error; err != nil {
+		return err
+	}
+
+	var block *throttleBlock
+	for _, row := range rows {
+		if row.BlockedUntil <= now.Unix() {
+			continue
+		}
+		wait := time.Until(time.Unix(row.BlockedUntil, 0))
+		if wait < time.Second {
+			wait = time.Second
+		}
+		if block == nil || wait > block.RetryAfter {
+			block = &throttleBlock{RetryAfter: wait, Locked: row.LockedUntil > now.Unix()}
+		}
+	}
+	if block != nil {
+		return block
+	}
+	return nil
+}
+
+// recordFailure counts a failed attempt for the key and reports whether it
+// just locked the key
+func recordFailure(tx *gorm.DB, scope, key string, p throttlePolicy, now time.Time) (bool, error) {
+	row := model.LoginThrottle{Scope: scope, Key: key}
+	if err := tx.Where("scope = ? AND key = ?", scope, key).FirstOrInit(&row).Error; err != nil {
+		return false, err
+	}
+	if row.LastFailure < now.Add(-p.window).Unix() {
+		row.Failures = 0
+	}
+	wasLocked := row.LockedUntil > now.Unix()
+
+	row.Failures++
+	row.LastFailure = now.Unix()
+	d, locked := p.delay(row.Failures)
+	row.BlockedUntil = now.Add(d).Unix()
+	if locked {
+		row.LockedUntil = row.BlockedUntil
+	}
+	if err := tx.Save(&row).Error; err != nil {
+		return false, err
+	}
+	return locked && !wasLocked, nil
+}
+
+// loginBlocked rejects the request with 429 if the account or IP is blocked
+func (s *AuthService) loginBlocked(c *gin.Context, userID, email string) bool {
+	err := checkThrottle(s.db, email, c.ClientIP(), time.Now())
+	var block *throttleBlock
+	if !errors.As(err, &block) {
+		if err != nil {
+			log.Printf("Failed to check login throttle: %v", err)
+		}
+		return false
+	}
+
+	s.audit(c, userID, auditLoginThrottled, email)
+	seconds := int(math.Ceil(block.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	msg := "too many failed attempts, try again later"
+	if block.Locked {
+		msg = "account temporarily locked, try again later"
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": msg, "retry_after": seconds})
+	return true
+}
+
+// loginFailed counts a failed attempt against the account and the IP and
+// sends the lockout email when the account gets locked. user is nil when the
+// email isn't registered.
+func (s *AuthService) loginFailed(c *gin.Context, user *model.User, email, reason string) {
+	now := time.Now()
+	ip := c.ClientIP()
+	userID := ""
+	if user != nil {
+		userID = user.ID
+	}
+	s.audit(c, userID, auditLoginFailed, reason)
+
+	var accountLocked, ipLocked bool
+	account := accountPolicy()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if accountLocked, err = recordFailure(tx, scopeAccount, email, account, now); err != nil {
+			return err
+		}
+		ipLocked, err = recordFailure(tx, scopeIP, ip, ipPolicy(), now)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+		return
+	}
+
+	if ipLocked {
+		s.audit(c, "", auditIPLocked, ip)
+	}
+	if accountLocked {
+		s.audit(c, userID, auditAccountLocked, email)
+		if user != nil {
+			s.sendMail(user.Email, "lockout", map[string]string{
+				"IP":         ip,
+				"LOCKED_FOR": strconv.Itoa(int(math.Ceil(account.lockoutFor.Minutes()))),
+			})
+		}
+	}
+}
+
+// loginSucceeded clears the account's failure count. The IP count is left to
+// expire so one valid account can't unlock an address.
+func (s *AuthService) loginSucceeded(c *gin.Context, user *model.User, method string) {
+	if err := s.db.Where("scope = ? AND key = ?", scopeAccount, normalizeEmail(user.Email)).
+		Delete(&model.LoginThrottle{}).Error; err != nil {
+		log.Printf("Failed to reset login throttle: %v", err)
+	}
+	s.audit(c, user.ID, auditLoginSucceeded, method)
+}
+
+// PruneLoginThrottles removes counters that no longer block anything
+func (s *AuthService) PruneLoginThrottles() {
+	now := time.Now()
+	window := accountPolicy().window
+	if w := ipPolicy().window; w > window {
+		window = w
+	}
+	if err := s.db.Where("last_failure < ? AND blocked_until < ?", now.Add(-window).Unix(), now.Unix()).
+		Delete(&model.LoginThrottle{}).Error; err != nil {
+		log.Printf("Failed to prune login throttles: %v", err)
+	}
+}
+
+// normalizeEmail is the throttle key for an account; accounts are looked up
+// by it as well, with LOWER(email)
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"halves/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottlePolicy(t *testing.T) {
+	p := throttlePolicy{
+		freeAttempts: 3,
+		baseDelay:    time.Second,
+		maxDelay:     time.Minute,
+		lockoutAfter: 10,
+		lockoutFor:   15 * time.Minute,
+	}
+
+	cases := []struct {
+		failures int
+		delay    time.Duration
+		locked   bool
+	}{
+		{1, 0, false},
+		{3, 0, false},
+		{4, time.Second, false},
+		{5, 2 * time.Second, false},
+		{6, 4 * time.Second, false},
+		{9, 32 * time.Second, false},
+		{10, 15 * time.Minute, true},
+		{25, 15 * time.Minute, true},
+	}
+	for _, tc := range cases {
+		d, locked := p.delay(tc.failures)
+		assert.Equal(t, tc.delay, d, "failures=%d", tc.failures)
+		assert.Equal(t, tc.locked, locked, "failures=%d", tc.failures)
+	}
+
+	t.Run("capped without overflow", func(t *testing.T) {
+		p.lockoutAfter = 1000
+		for _, failures := range []int{10, 64, 200} {
+			d, _ := p.delay(failures)
+			assert.Equal(t, time.Minute, d, "failures=%d", failures)
+		}
+	})
+}
+
+func TestLoginEmailCase(t *testing.T) {
+	s := newTestAuthService(t)
+	require.NoError(t, s.db.AutoMigrate(&model.LoginThrottle{}, &model.AuditLog{}))
+	hashed, err := hashPassword("password123")
+	require.NoError(t, err)
+	require.NoError(t, s.db.Create(&model.User{ID: "user-1", Email: "Alice@Example.com", Password: hashed, CreatedAt: time.Now().Unix()}).Error)
+
+	r := gin.New()
+	r.POST("/register", s.Register)
+	r.POST("/login", s.Login)
+	post := func(path, email, password string) int {
+		w := httptest.NewRecorder()
+		body := `{"email":"` + email + `","password":"` + password + `"}`
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// a failure in any case counts against the one account
+	assert.Equal(t, http.StatusUnauthorized, post("/login", "ALICE@example.com", "wrong-password"))
+	var throttle model.LoginThrottle
+	require.NoError(t, s.db.Where("scope = ?", scopeAccount).First(&throttle).Error)
+	assert.Equal(t, "alice@example.com", throttle.Key)
+
+	assert.Equal(t, http.StatusOK, post("/login", "alice@example.com", "password123"))
+	assert.Equal(t, http.StatusConflict, post("/register", "alice@EXAMPLE.com", "password123"))
+}
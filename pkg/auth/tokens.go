@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"halves/pkg/model"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	errRefreshInvalid = errors.New("invalid refresh token")
+	errRefreshReused  = errors.New("refresh token reuse detected")
+)
+
+// tokenPair is what every successful sign-in hands back to the client
+type tokenPair struct {
+	UserID           string
+	AccessToken      string
+	AccessExpiresAt  int64
+	RefreshToken     string
+	RefreshExpiresAt int64
+}
+
+func accessTokenTTL() time.Duration {
+	return envDuration("ACCESS_TOKEN_TTL", defaultAccessTokenTTL)
+}
+
+func refreshTokenTTL() time.Duration {
+	return envDuration("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL)
+}
+
+func signClaims(claims jwt.MapClaims) (string, error) {
+	ring, err := currentKeyRing()
+	if err != nil {
+		return "", err
+	}
+	return ring.Sign(claims)
+}
+
+func signAccessToken(userID, jti string, exp int64) (string, error) {
+	return signClaims(jwt.MapClaims{
+		"sub": userID, // Subject
+		"exp": exp,    // Expiration
+		"iat": time.Now().Unix(),
+		"jti": jti, // Lets the token be revoked before it expires
+	})
+}
+
+// parseTypedToken validates a token we signed for a purpose other than API
+// access, e.g. the 2FA login challenge
+func parseTypedToken(tokenString, typ string) (jwt.MapClaims, error) {
+	ring, err := currentKeyRing()
+	if err != nil {
+		return nil, err
+	}
+	claims, err := ring.Parse(tokenString, jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("invalid or expired token")
+	}
+	if claims["typ"] != typ {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+	if jti, _ := claims["jti"].(string); jti != "" && revoked.contains(jti) {
+		return nil, fmt.Errorf("token already used")
+	}
+	return claims, nil
+}
+
+// newOpaqueToken returns a random URL-safe token and its hex sha256, which is
+// the only form we keep in the database
+func newOpaqueToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens signs an access token and stores a new refresh token for the
+// device. An empty familyID starts a new rotation chain.
+func (s *AuthService) issueTokens(tx *gorm.DB, userID, deviceID, familyID string) (*tokenPair, error) {
+	now := time.Now()
+	if familyID == "" {
+		familyID = generateUUID()
+	}
+
+	jti := generateUUID()
+	exp := now.Add(accessTokenTTL()).Unix()
+	access, err := signAccessToken(userID, jti, exp)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, refreshHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	row := model.RefreshToken{
+		ID:              generateUUID(),
+		UserID:          userID,
+		DeviceID:        deviceID,
+		FamilyID:        familyID,
+		TokenHash:       refreshHash,
+		CreatedAt:       now.Unix(),
+		ExpiresAt:       now.Add(refreshTokenTTL()).Unix(),
+		AccessJTI:       jti,
+		AccessExpiresAt: exp,
+	}
+	if err := tx.Create(&row).Error; err != nil {
+		return nil, err
+	}
+
+	return &tokenPair{
+		UserID:           userID,
+		AccessToken:      access,
+		AccessExpiresAt:  exp,
+		RefreshToken:     refresh,
+		RefreshExpiresAt: row.ExpiresAt,
+	}, nil
+}
+
+// rotateRefreshToken consumes a refresh token and issues its successor in the
+// same family. Reuse of an already rotated token revokes the whole family.
+func (s *AuthService) rotateRefreshToken(tx *gorm.DB, token, deviceID string) (*tokenPair, error) {
+	now := time.Now().Unix()
+
+	var current model.RefreshToken
+	if err := tx.Where("token_hash = ?", hashToken(token)).First(&current).Error; err != nil {
+		return nil, errRefreshInvalid
+	}
+	if current.RevokedAt != 0 || current.ExpiresAt < now {
+		return nil, errRefreshInvalid
+	}
+	// Reuse is checked first: a stolen token replayed from another device
+	// must still revoke the family
+	if current.UsedAt != 0 {
+		return nil, errRefreshReused
+	}
+	if current.DeviceID != "" && current.DeviceID != deviceID {
+		return nil, errRefreshInvalid
+	}
+
+	// Conditional update so two concurrent refreshes can't both win
+	result := tx.Model(&model.RefreshToken{}).
+		Where("id = ? AND used_at = 0", current.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errRefreshReused
+	}
+
+	return s.issueTokens(tx, current.UserID, current.DeviceID, current.FamilyID)
+}
+
+// revokeRefreshFamily revokes every token in the family of the given token
+func (s *AuthService) revokeRefreshFamily(token string) error {
+	var current model.RefreshToken
+	if err := s.db.Where("token_hash = ?", hashToken(token)).First(&current).Error; err != nil {
+		return err
+	}
+	return revokeRefreshTokens(s.db, "family_id = ?", current.FamilyID)
+}
+
+func respondWithTokens(c *gin.Context, pair *tokenPair) {
+	c.JSON(http.StatusOK, gin.H{
+		"token":              pair.AccessToken,
+		"expires_in":         pair.AccessExpiresAt,
+		"refresh_token":      pair.RefreshToken,
+		"refresh_expires_in": pair.RefreshExpiresAt,
+		"uuid":               pair.UserID,
+	})
+}
+
+// RefreshToken exchanges a refresh token for a new access/refresh pair
+func (s *AuthService) RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var pair *tokenPair
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pair, err = s.rotateRefreshToken(tx, req.RefreshToken, c.GetHeader("X-Device-ID"))
+		return err
+	})
+
+	switch {
+	case errors.Is(err, errRefreshReused):
+		// Revoke outside the failed transaction so it sticks
+		if err := s.revokeRefreshFamily(req.RefreshToken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errRefreshReused.Error()})
+		return
+	case errors.Is(err, errRefreshInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errRefreshInvalid.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
+		return
+	}
+
+	s.touchDevice(c, pair.UserID, c.GetHeader("X-Device-ID"))
+	respondWithTokens(c, pair)
+}
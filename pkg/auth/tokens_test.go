@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"encoding/json"
+	"halves/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestAuthService signs with testSecret, keeps its data in memory and
+// starts with an empty revocation list
+func newTestAuthService(t *testing.T) *AuthService {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("JWT_KEYS_FILE", "")
+	ring, err := LoadKeyRing()
+	require.NoError(t, err)
+	keyRingMu.RLock()
+	previousRing := keyRing
+	keyRingMu.RUnlock()
+	SetKeyRing(ring)
+	previousRevoked := revoked
+	revoked = &revocationList{jtis: make(map[string]int64)}
+	t.Cleanup(func() {
+		SetKeyRing(previousRing)
+		revoked = previousRevoked
+	})
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.RefreshToken{}, &model.RevokedToken{}, &model.ActionToken{}, &model.Device{}))
+	return &AuthService{db: db}
+}
+
+// issueTestTokens signs in user-1 on the device
+func issueTestTokens(t *testing.T, s *AuthService, deviceID string) *tokenPair {
+	pair, err := s.issueTokens(s.db, "user-1", deviceID, "")
+	require.NoError(t, err)
+	return pair
+}
+
+func refreshRequest(r *gin.Engine, refreshToken, deviceID string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/token/refresh", strings.NewReader(`{"refresh_token":"`+refreshToken+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Device-ID", deviceID)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	s := newTestAuthService(t)
+	first := issueTestTokens(t, s, "dev-1")
+
+	_, err := s.rotateRefreshToken(s.db, first.RefreshToken, "dev-2")
+	assert.ErrorIs(t, err, errRefreshInvalid, "refresh tokens are bound to their device")
+	_, err = s.rotateRefreshToken(s.db, "unknown", "dev-1")
+	assert.ErrorIs(t, err, errRefreshInvalid)
+
+	second, err := s.rotateRefreshToken(s.db, first.RefreshToken, "dev-1")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", second.UserID)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.NotEqual(t, first.AccessToken, second.AccessToken)
+
+	var rows []model.RefreshToken
+	require.NoError(t, s.db.Find(&rows).Error)
+	require.Len(t, rows, 2)
+	assert.Equal(t, rows[0].FamilyID, rows[1].FamilyID, "rotation stays in the family")
+	used := 0
+	for _, row := range rows {
+		assert.NotEqual(t, first.RefreshToken, row.TokenHash, "only hashes are stored")
+		if row.UsedAt != 0 {
+			used++
+			assert.Equal(t, hashToken(first.RefreshToken), row.TokenHash)
+		}
+	}
+	assert.Equal(t, 1, used)
+
+	// the successor rotates in turn
+	_, err = s.rotateRefreshToken(s.db, second.RefreshToken, "dev-1")
+	assert.NoError(t, err)
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	s := newTestAuthService(t)
+	r := gin.New()
+	r.POST("/token/refresh", s.RefreshToken)
+
+	first := issueTestTokens(t, s, "dev-1")
+	other := issueTestTokens(t, s, "dev-2")
+
+	w := refreshRequest(r, first.RefreshToken, "dev-1")
+	require.Equal(t, http.StatusOK, w.Code)
+	var second struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+
+	// replaying the rotated token, even from another device, ends the family
+	w = refreshRequest(r, first.RefreshToken, "dev-3")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), errRefreshReused.Error())
+
+	w = refreshRequest(r, second.RefreshToken, "dev-1")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), errRefreshInvalid.Error())
+
+	var successor model.RefreshToken
+	require.NoError(t, s.db.Where("token_hash = ?", hashToken(second.RefreshToken)).First(&successor).Error)
+	assert.NotZero(t, successor.RevokedAt)
+	assert.True(t, revoked.contains(successor.AccessJTI), "the access token of the family is revoked too")
+
+	// other sessions of the user keep working
+	w = refreshRequest(r, other.RefreshToken, "dev-2")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
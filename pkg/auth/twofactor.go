@@ -0,0 +1,302 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"halves/pkg/model"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var errSecondFactorInvalid = errors.New("invalid code")
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Halves"
+}
+
+// newMFAChallenge signs the short-lived token returned by Login when the
+// password was right but a second factor is still required
+func newMFAChallenge(userID string) (string, int64, error) {
+	exp := time.Now().Add(mfaChallengeTTL).Unix()
+	token, err := signClaims(jwt.MapClaims{
+		"sub": userID,
+		"exp": exp,
+		"iat": time.Now().Unix(),
+		"jti": generateUUID(),
+		"typ": "mfa_challenge",
+	})
+	return token, exp, err
+}
+
+// generateRecoveryCodes replaces the user's recovery codes and returns the
+// new plaintext codes, formatted as xxxxx-xxxxx
+func generateRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	now := time.Now().Unix()
+	for i := range codes {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(buf))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		if err := tx.Create(&model.RecoveryCode{
+			UserID:    userID,
+			CodeHash:  hashToken(raw),
+			CreatedAt: now,
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code and burns whichever was used
+func verifySecondFactor(tx *gorm.DB, user *model.User, code, recoveryCode string) error {
+	if code != "" {
+		step, ok := validateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+		if !ok {
+			return errSecondFactorInvalid
+		}
+		// Conditional update so the same code can't be used twice concurrently
+		result := tx.Model(&model.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errSecondFactorInvalid
+		}
+		return nil
+	}
+
+	if recoveryCode != "" {
+		normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(recoveryCode))
+		result := tx.Model(&model.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at = 0", user.ID, hashToken(normalized)).
+			Update("used_at", time.Now().Unix())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errSecondFactorInvalid
+		}
+		return nil
+	}
+
+	return errSecondFactorInvalid
+}
+
+// EnrollTOTP starts 2FA enrollment: it stores a new secret and returns it as
+// plain text, otpauth URI and QR code. 2FA is enforced only after EnableTOTP.
+func (s *AuthService) EnrollTOTP(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication already enabled"})
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+		return
+	}
+	uri := totpURI(totpIssuer(), user.Email, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate qr code"})
+		return
+	}
+
+	if err := s.db.Model(&user).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": uri,
+		"qr_png":      base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// EnableTOTP confirms enrollment with a code from the authenticator app and
+// returns the recovery codes, which are shown only this once
+func (s *AuthService) EnableTOTP(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.MustGet("userID").(string)
+
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+		if user.TOTPEnabled || user.TOTPSecret == "" {
+			return errSecondFactorInvalid
+		}
+		if err := verifySecondFactor(tx, &user, req.Code, ""); err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if errors.Is(err, errSecondFactorInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "two-factor authentication enabled", "recovery_codes": codes})
+}
+
+// DisableTOTP turns 2FA off after re-checking the password and a second factor
+func (s *AuthService) DisableTOTP(c *gin.Context) {
+	var req struct {
+		Password     string `json:"password" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.MustGet("userID").(string)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+		if ok, _ := verifyPassword(req.Password, user.Password); !ok || !user.TOTPEnabled {
+			return errSecondFactorInvalid
+		}
+		if err := verifySecondFactor(tx, &user, req.Code, req.RecoveryCode); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled": false,
+			"totp_secret":  "",
+		}).Error
+	})
+	if errors.Is(err, errSecondFactorInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "two-factor authentication disabled"})
+}
+
+// LoginTOTP completes a login that returned an mfa challenge
+func (s *AuthService) LoginTOTP(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := parseTypedToken(req.ChallengeToken, "mfa_challenge")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired challenge"})
+		return
+	}
+	userID, _ := claims["sub"].(string)
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	// Wrong codes count towards the same lockout as wrong passwords
+	email := normalizeEmail(user.Email)
+	if s.loginBlocked(c, user.ID, email) {
+		return
+	}
+
+	var pair *tokenPair
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, &user, req.Code, req.RecoveryCode); err != nil {
+			return err
+		}
+		var err error
+		pair, err = s.issueTokens(tx, user.ID, c.GetHeader("X-Device-ID"), "")
+		return err
+	})
+	if errors.Is(err, errSecondFactorInvalid) {
+		s.loginFailed(c, &user, email, "bad second factor")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	s.loginSucceeded(c, &user, "2fa")
+
+	// The challenge is single use
+	if err := revokeAccessToken(s.db, userID, jti, int64(exp)); err != nil {
+		log.Printf("Failed to revoke mfa challenge: %v", err)
+	}
+
+	s.touchDevice(c, pair.UserID, c.GetHeader("X-Device-ID"))
+	respondWithTokens(c, pair)
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"errors"
+	"halves/pkg/model"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// Minimum pause between two verification emails for the same user
+	verificationResendInterval = time.Minute
+	// Maximum verification emails per user and day
+	verificationDailyLimit = 5
+)
+
+func emailVerificationTTL() time.Duration {
+	return envDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+}
+
+// sendVerificationEmail creates a fresh verification token and mails it
+func (s *AuthService) sendVerificationEmail(user *model.User) error {
+	ttl := emailVerificationTTL()
+	token, err := createActionToken(s.db, user.ID, purposeVerifyEmail, user.Email, ttl)
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(user.Email, "verify", map[string]string{
+		"TOKEN":      token,
+		"VERIFY_URL": actionURL("EMAIL_VERIFICATION_URL", token),
+		"EXPIRES_IN": strconv.Itoa(int(ttl.Hours())),
+	})
+	return nil
+}
+
+// VerifyEmail redeems the token from the verification email
+func (s *AuthService) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeActionToken(tx, req.Token, purposeVerifyEmail)
+		if err != nil {
+			return err
+		}
+		// The token is only good for the address it was sent to
+		result := tx.Model(&model.User{}).
+			Where("id = ? AND email = ?", token.UserID, token.Data).
+			Update("email_verified", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errActionTokenInvalid
+		}
+		return nil
+	})
+	if errors.Is(err, errActionTokenInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "email verified"})
+}
+
+// ResendVerification sends a new verification email to the current user
+func (s *AuthService) ResendVerification(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusConflict, gin.H{"error": "email already verified"})
+		return
+	}
+
+	now := time.Now()
+	var last model.ActionToken
+	if err := s.db.Where("user_id = ? AND purpose = ?", userID, purposeVerifyEmail).
+		Order("created_at desc").First(&last).Error; err == nil &&
+		last.CreatedAt > now.Add(-verificationResendInterval).Unix() {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "please wait before requesting another email"})
+		return
+	}
+
+	var sent int64
+	s.db.Model(&model.ActionToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purposeVerifyEmail, now.Add(-24*time.Hour).Unix()).
+		Count(&sent)
+	if sent >= verificationDailyLimit {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many verification emails, try again tomorrow"})
+		return
+	}
+
+	if err := s.sendVerificationEmail(&user); err != nil {
+		log.Printf("Failed to create verification token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "verification email sent"})
+}
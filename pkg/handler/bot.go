@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"errors"
+	"halves/pkg/model"
+	"halves/pkg/strategy"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// botNamespace derives stable user ids for the bots, so they are the same
+// on every server
+var botNamespace = uuid.MustParse("6f0f3f57-9c1e-4d55-a7e3-1b2c8d4e5f60")
+
+func botID(name string) string {
+	return uuid.NewSHA1(botNamespace, []byte(name)).String()
+}
+
+// EnsureBots creates a bot user for every strategy. Bots have no password and
+// an unroutable address, so nobody can log in as one.
+func (h *GameHandler) EnsureBots() error {
+	now := time.Now().Unix()
+	for _, s := range strategy.All() {
+		user := model.User{
+			ID:            botID(s.Name()),
+			Email:         s.Name() + "@bots.invalid",
+			CreatedAt:     now,
+			LastSeen:      now,
+			EmailVerified: true,
+			Strategy:      s.Name(),
+		}
+		if err := h.db.Where(model.User{ID: user.ID}).FirstOrCreate(&user).Error; err != nil {
+			return err
+		}
+		h.bots[user.ID] = s
+	}
+	return nil
+}
+
+// ResumeBots answers the invites and plays the rounds bots missed while the
+// server was down
+func (h *GameHandler) ResumeBots() error {
+	ids := make([]string, 0, len(h.bots))
+	for id := range h.bots {
+		ids = append(ids, id)
+	}
+
+	var games []model.Game
+	if err := h.db.Where("(status = ? AND receiver IN ?) OR (status = ? AND (sender IN ? OR receiver IN ?))",
+		model.GameStatusPending, ids, model.GameStatusOpen, ids, ids).
+		Find(&games).Error; err != nil {
+		return err
+	}
+	for i := range games {
+		if games[i].Status == model.GameStatusPending {
+			go h.botAccept(games[i].ID, games[i].Receiver)
+		} else {
+			h.playBots(&games[i])
+		}
+	}
+	return nil
+}
+
+// botAccept accepts an invite sent to a bot
+func (h *GameHandler) botAccept(gameID uint, botID string) {
+	if _, err := h.answer(botID, gameID, true, model.GameStatusOpen, "game_accepted"); err != nil && !errors.Is(err, errNotPending) {
+		log.Printf("Bot %s failed to accept game %d: %v", botID, gameID, err)
+	}
+}
+
+// playBots lets the bots of an open game vote in its current round
+func (h *GameHandler) playBots(game *model.Game) {
+	for _, player := range []string{game.Sender, game.Receiver} {
+		if s, ok := h.bots[player]; ok {
+			go h.botVote(s, player, game.ID)
+		}
+	}
+}
+
+// botVote picks the bot's vote from the finished rounds and casts it like a
+// player would
+func (h *GameHandler) botVote(s strategy.Strategy, botID string, gameID uint) {
+	var game model.Game
+	if err := h.db.First(&game, gameID).Error; err != nil {
+		log.Printf("Bot %s failed to load game %d: %v", botID, gameID, err)
+		return
+	}
+	if game.Status != model.GameStatusOpen {
+		return
+	}
+
+	var rounds []model.Round
+	if err := h.db.Where("game_id = ?", gameID).Order("number").Find(&rounds).Error; err != nil {
+		log.Printf("Bot %s failed to load rounds of game %d: %v", botID, gameID, err)
+		return
+	}
+	history := make([]strategy.Round, len(rounds))
+	for i, r := range rounds {
+		if game.Sender == botID {
+			history[i] = strategy.Round{Own: r.Svote, Opponent: r.Rvote}
+		} else {
+			history[i] = strategy.Round{Own: r.Rvote, Opponent: r.Svote}
+		}
+	}
+
+	// already voted in this round or the game moved on
+	if _, err := h.vote(botID, gameID, s.Move(history)); err != nil && !errors.Is(err, errInvalidVote) {
+		log.Printf("Bot %s failed to vote in game %d: %v", botID, gameID, err)
+	}
+}
+
+// GetBots lists the bots players can invite
+func (h *GameHandler) GetBots(c *gin.Context) {
+	response := []gin.H{}
+	for _, s := range strategy.All() {
+		id := botID(s.Name())
+		if _, ok := h.bots[id]; !ok {
+			continue
+		}
+		response = append(response, gin.H{
+			"id":          id,
+			"strategy":    s.Name(),
+			"description": s.Description(),
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
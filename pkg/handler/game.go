@@ -1,8 +1,15 @@
 package handler
 
 import (
+	"errors"
 	"halves/pkg/model"
+	"halves/pkg/payoff"
+	"halves/pkg/strategy"
+	"log"
+	"math/rand/v2"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,35 +18,156 @@ import (
 
 // Add at the top
 type GameDTO struct {
-	ID       uint      `json:"id"`
-	Sender   string    `json:"sender"`
-	Receiver string    `json:"receiver"`
-	Created  time.Time `json:"created"`
+	ID       uint          `json:"id"`
+	Sender   string        `json:"sender"`
+	Receiver string        `json:"receiver"`
+	Created  time.Time     `json:"created"`
+	Status   string        `json:"status"`
+	Deadline int64         `json:"deadline"`
+	Type     string        `json:"type"`
+	Payoff   payoff.Matrix `json:"payoff"`
+	Rounds   int           `json:"rounds"`
+	StopProb float64       `json:"stop_probability"`
 }
 type GameResponse struct {
-	ID       uint      `json:"id"`
-	Sender   string    `json:"sender"`
-	Receiver string    `json:"receiver"`
-	Created  time.Time `json:"created_at"`
-	Status   string    `json:"status"`
+	ID       uint          `json:"id"`
+	Sender   string        `json:"sender"`
+	Receiver string        `json:"receiver"`
+	Created  time.Time     `json:"created_at"`
+	Status   string        `json:"status"`
+	Deadline int64         `json:"deadline"`
+	Type     string        `json:"type"`
+	Payoff   payoff.Matrix `json:"payoff"`
+	Rounds   int           `json:"rounds"`
+	StopProb float64       `json:"stop_probability"`
+	Round    int           `json:"round"`
+	// points of the finished rounds, credited to the results at the end
+	SenderScore   int   `json:"sender_score"`
+	ReceiverScore int   `json:"receiver_score"`
+	ClosedAt      int64 `json:"closed_at,omitempty"`
 }
+
+// RoundResponse is a finished round, visible to both players
+type RoundResponse struct {
+	Number        int   `json:"number"`
+	SenderVote    int   `json:"sender_vote"`
+	ReceiverVote  int   `json:"receiver_vote"`
+	SenderScore   int   `json:"sender_score"`
+	ReceiverScore int   `json:"receiver_score"`
+	TimedOut      bool  `json:"timed_out"`
+	FinishedAt    int64 `json:"finished_at"`
+}
+
+func newRoundResponse(round *model.Round) RoundResponse {
+	return RoundResponse{
+		Number:        round.Number,
+		SenderVote:    round.Svote,
+		ReceiverVote:  round.Rvote,
+		SenderScore:   round.Sscore,
+		ReceiverScore: round.Rscore,
+		TimedOut:      round.TimedOut,
+		FinishedAt:    round.CreatedAt,
+	}
+}
+
+func newGameDTO(game *model.Game) GameDTO {
+	return GameDTO{
+		ID:       game.ID,
+		Sender:   game.Sender,
+		Receiver: game.Receiver,
+		Created:  game.Created,
+		Status:   game.Status,
+		Deadline: game.Deadline,
+		Type:     game.Type,
+		Payoff:   gameMatrix(game),
+		Rounds:   game.Rounds,
+		StopProb: game.StopProbability,
+	}
+}
+
+func newGameResponse(game *model.Game) GameResponse {
+	return GameResponse{
+		ID:       game.ID,
+		Sender:   game.Sender,
+		Receiver: game.Receiver,
+		Created:  game.Created,
+		Status:   game.Status,
+		Deadline: game.Deadline,
+		Type:     game.Type,
+		Payoff:   gameMatrix(game),
+		Rounds:   game.Rounds,
+		StopProb: game.StopProbability,
+		Round:    game.Round,
+
+		SenderScore:   game.Sscore,
+		ReceiverScore: game.Rscore,
+		ClosedAt:      game.ClosedAt,
+	}
+}
+
+// gameMatrix returns the payoff the game is scored with
+func gameMatrix(game *model.Game) payoff.Matrix {
+	if game.Type == payoff.Custom {
+		return payoff.Matrix{
+			Reward:     game.Reward,
+			Sucker:     game.Sucker,
+			Temptation: game.Temptation,
+			Punishment: game.Punishment,
+		}
+	}
+	m, err := payoff.Resolve(game.Type, nil)
+	if err != nil {
+		// types are validated on invite, this is a game of a removed type
+		m, _ = payoff.Resolve(payoff.PrisonersDilemma, nil)
+	}
+	return m
+}
+
+// Game timeouts, overridable with GAME_TIMEOUT and GAME_MAX_TIMEOUT
+const (
+	defaultGameTimeout   = 2 * time.Hour
+	defaultInviteTimeout = 24 * time.Hour
+	maxGameTimeout       = 7 * 24 * time.Hour
+	minGameTimeout       = time.Minute
+	maxGameRounds        = 100
+)
+
+func gameTimeoutEnv(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
 type ReslutHandler struct {
 	db *gorm.DB
 }
 
 type GameHandler struct {
-	db  *gorm.DB
-	hub *Hub
+	db   *gorm.DB
+	hub  *Hub
+	bots map[string]strategy.Strategy // by user id, filled by EnsureBots
 }
 
 func NewReslutHandler(db *gorm.DB) *ReslutHandler {
 	return &ReslutHandler{db: db}
 }
 
+// GetResult returns the top 100 by score, or by rating with ?order=rating
 func (h *ReslutHandler) GetResult(c *gin.Context) {
 	var entries []model.Result
 
-	result := h.db.Order("score DESC").Limit(100).Find(&entries)
+	order := "score DESC"
+	switch c.Query("order") {
+	case "", "score":
+	case "rating":
+		order = "rating DESC, rated_games DESC"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be score or rating"})
+		return
+	}
+
+	result := h.db.Order(order).Limit(100).Find(&entries)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch result"})
 		return
@@ -49,23 +177,88 @@ func (h *ReslutHandler) GetResult(c *gin.Context) {
 }
 
 func NewGameHandler(db *gorm.DB, hub *Hub) *GameHandler {
-	return &GameHandler{db: db, hub: hub}
+	return &GameHandler{db: db, hub: hub, bots: map[string]strategy.Strategy{}}
+}
+
+// GameOptions are the rules of a new game, shared by invites and tournaments
+type GameOptions struct {
+	Timeout  int64          `json:"timeout" binding:"min=0"` // seconds, 0 - default
+	Type     string         `json:"type"`                    // prisoners_dilemma by default
+	Payoff   *payoff.Matrix `json:"payoff"`                  // only for custom
+	Rounds   int            `json:"rounds" binding:"min=0,max=100"`
+	StopProb float64        `json:"stop_probability" binding:"min=0,lt=1"`
+}
+
+// newGame validates the options and returns a game with them; the error is
+// meant for the client
+func (o GameOptions) newGame(sender, receiver string) (model.Game, error) {
+	timeout := gameTimeoutEnv("GAME_TIMEOUT", defaultGameTimeout)
+	if o.Timeout > 0 {
+		timeout = time.Duration(o.Timeout) * time.Second
+		if max := gameTimeoutEnv("GAME_MAX_TIMEOUT", maxGameTimeout); timeout < minGameTimeout || timeout > max {
+			return model.Game{}, errors.New("timeout must be between 60 and " + strconv.Itoa(int(max.Seconds())) + " seconds")
+		}
+	}
+
+	matrix, err := payoff.Resolve(o.Type, o.Payoff)
+	if err != nil {
+		return model.Game{}, err
+	}
+	if o.Type == "" {
+		o.Type = payoff.PrisonersDilemma
+	}
+	// with a stop probability the number of rounds is only an upper bound
+	if o.Rounds == 0 {
+		o.Rounds = 1
+		if o.StopProb > 0 {
+			o.Rounds = maxGameRounds
+		}
+	}
+
+	// the round timeout starts when the receiver accepts
+	now := time.Now()
+	game := model.Game{
+		Sender:   sender,
+		Receiver: receiver,
+		Created:  now,
+		Status:   model.GameStatusPending,
+		Timeout:  int64(timeout.Seconds()),
+		Deadline: now.Add(gameTimeoutEnv("GAME_INVITE_TIMEOUT", defaultInviteTimeout)).Unix(),
+		Type:     o.Type,
+		Rounds:   o.Rounds,
+		Round:    1,
+
+		StopProbability: o.StopProb,
+	}
+	if o.Type == payoff.Custom {
+		game.Reward = matrix.Reward
+		game.Sucker = matrix.Sucker
+		game.Temptation = matrix.Temptation
+		game.Punishment = matrix.Punishment
+	}
+	return game, nil
 }
 
 func (h *GameHandler) CreateGame(c *gin.Context) {
 	var req struct {
 		Receiver string `json:"receiver" binding:"required,uuid"`
+		GameOptions
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// a player can't vote for both sides
+	if req.Receiver == c.MustGet("userID").(string) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot invite yourself"})
+		return
+	}
 
-	game := model.Game{
-		Sender:   c.MustGet("userID").(string),
-		Receiver: req.Receiver,
-		Created:  time.Now(),
+	game, err := req.newGame(c.MustGet("userID").(string), req.Receiver)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	if result := h.db.Create(&game); result.Error != nil {
@@ -76,70 +269,176 @@ func (h *GameHandler) CreateGame(c *gin.Context) {
 	// Send limited game data
 	h.sendGameNotification(game.Receiver, gin.H{
 		"type": "game_invite",
-		"game": GameDTO{
-			ID:       game.ID,
-			Sender:   game.Sender,
-			Receiver: game.Receiver,
-			Created:  game.Created,
-		},
+		"game": newGameDTO(&game),
 	})
 
 	// Start game timeout
-	go h.gameTimeoutWorker(game.ID)
+	h.scheduleTimeout(game.ID, game.Deadline)
 
-	c.JSON(http.StatusCreated, GameDTO{
-		ID:       game.ID,
-		Sender:   game.Sender,
-		Receiver: game.Receiver,
-		Created:  game.Created,
+	// bots accept every invite
+	if _, ok := h.bots[game.Receiver]; ok {
+		go h.botAccept(game.ID, game.Receiver)
+	}
+
+	c.JSON(http.StatusCreated, newGameDTO(&game))
+}
+
+// scheduleTimeout expires the game at its deadline. The deadline is stored
+// on the game, so ResumeTimeouts can schedule it again after a restart.
+func (h *GameHandler) scheduleTimeout(gameID uint, deadline int64) {
+	time.AfterFunc(time.Until(time.Unix(deadline, 0)), func() {
+		h.expireGame(gameID)
 	})
 }
 
-func (h *GameHandler) gameTimeoutWorker(gameID uint) {
-	time.AfterFunc(2*time.Hour, func() {
-		h.db.Transaction(func(tx *gorm.DB) error {
-			var game model.Game
-			if err := tx.First(&game, gameID).Error; err != nil {
+// ResumeTimeouts schedules the deadlines of all games that are still open,
+// firing right away for those that passed while the server was down
+func (h *GameHandler) ResumeTimeouts() error {
+	var games []model.Game
+	if err := h.db.Select("id", "created", "timeout", "deadline").
+		Where("status IN ?", []string{model.GameStatusPending, model.GameStatusOpen}).
+		Find(&games).Error; err != nil {
+		return err
+	}
+	for _, game := range games {
+		// games created before deadlines were stored
+		if game.Deadline == 0 {
+			game.Deadline = game.Created.Add(time.Duration(game.Timeout) * time.Second).Unix()
+			if err := h.db.Model(&game).Update("deadline", game.Deadline).Error; err != nil {
 				return err
 			}
+		}
+		h.scheduleTimeout(game.ID, game.Deadline)
+	}
+	log.Printf("Scheduled %d game timeouts", len(games))
+	return nil
+}
 
-			if game.Status == "open" {
-				// Set default votes if not voted
-				game.Rvote = +1
-				game.Status = "closed"
-				if err := tx.Save(&game).Error; err != nil {
-					return err
-				}
-
-				h.calculateScores(tx, &game)
-
-				h.sendGameNotification(game.Sender, gin.H{
-					"type": "game_timeout",
-					"game": GameResponse{
-						ID:       game.ID,
-						Sender:   game.Sender,
-						Receiver: game.Receiver,
-						Created:  game.Created,
-						Status:   game.Status,
-					},
-				})
-
-				h.sendGameNotification(game.Receiver, gin.H{
-					"type": "game_timeout",
-					"game": GameResponse{
-						ID:       game.ID,
-						Sender:   game.Sender,
-						Receiver: game.Receiver,
-						Created:  game.Created,
-						Status:   game.Status,
-					},
-				})
+// BackfillRounds stores the votes of games closed before rounds were stored
+// as their round 1, with the points they were credited, so history, stats and
+// leaderboards count them as played
+func BackfillRounds(db *gorm.DB) error {
+	var games []model.Game
+	if err := db.Where("status = ? AND svote <> 0 AND rvote <> 0", model.GameStatusClosed).
+		Where("NOT EXISTS (SELECT 1 FROM rounds WHERE rounds.game_id = games.id)").
+		Find(&games).Error; err != nil {
+		return err
+	}
+	if len(games) == 0 {
+		return nil
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range games {
+			game := &games[i]
+			sscore, rscore, ok := gameMatrix(game).Scores(game.Svote, game.Rvote)
+			if !ok {
+				continue
+			}
+			// the close time wasn't stored, the creation is the best guess
+			round := model.Round{
+				GameID:    game.ID,
+				Number:    1,
+				Svote:     game.Svote,
+				Rvote:     game.Rvote,
+				Sscore:    sscore,
+				Rscore:    rscore,
+				CreatedAt: game.Created.Unix(),
+			}
+			if err := tx.Create(&round).Error; err != nil {
+				return err
 			}
+			if err := tx.Model(game).Updates(map[string]interface{}{"sscore": sscore, "rscore": rscore}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		log.Printf("Backfilled rounds of %d games", len(games))
+	}
+	return err
+}
+
+// expireGame expires a pending invite or ends an open game once the
+// deadline of its current round passed. A player who didn't vote counts as
+// an upvote, so the reward goes to the player who voted; a round nobody voted
+// in isn't played.
+func (h *GameHandler) expireGame(gameID uint) {
+	var game model.Game
+	var round *model.Round
+	outcome := roundLost
+	expired := false
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&game, gameID).Error; err != nil {
+			return err
+		}
+		if game.Deadline > time.Now().Unix() {
 			return nil
-		})
+		}
+		// unanswered invites expire without a round being played
+		if game.Status == model.GameStatusPending {
+			result := tx.Model(&model.Game{}).
+				Where("id = ? AND status = ? AND deadline = ?", game.ID, model.GameStatusPending, game.Deadline).
+				Update("status", model.GameStatusExpired)
+			expired = result.RowsAffected == 1
+			game.Status = model.GameStatusExpired
+			return result.Error
+		}
+		if game.Status != model.GameStatusOpen {
+			return nil
+		}
+
+		// Set default votes if not voted
+		svote, rvote := game.Svote, game.Rvote
+		if svote != 0 || rvote != 0 {
+			if svote == 0 {
+				svote = 1
+			}
+			if rvote == 0 {
+				rvote = 1
+			}
+		}
+
+		var err error
+		outcome, round, err = h.finishRound(tx, &game, svote, rvote, true)
+		return err
 	})
+	if err != nil {
+		log.Printf("Failed to time out game %d: %v", gameID, err)
+		return
+	}
+	if expired {
+		notification := gin.H{
+			"type": "game_expired",
+			"game": newGameResponse(&game),
+		}
+		h.sendGameNotification(game.Sender, notification)
+		h.sendGameNotification(game.Receiver, notification)
+		return
+	}
+	if outcome != roundClosed {
+		return
+	}
+
+	notification := gin.H{
+		"type": "game_timeout",
+		"game": newGameResponse(&game),
+	}
+	if round != nil {
+		notification["round"] = newRoundResponse(round)
+	}
+	h.sendGameNotification(game.Sender, notification)
+	h.sendGameNotification(game.Receiver, notification)
+	if game.TournamentID != 0 {
+		h.tournamentMatchDone(&game)
+	}
 }
 
+var (
+	errGameNotFound = errors.New("game not found")
+	errInvalidVote  = errors.New("invalid vote operation")
+)
+
 func (h *GameHandler) HandleVote(c *gin.Context) {
 	var req struct {
 		GameID uint `json:"game_id" binding:"required"`
@@ -151,119 +450,355 @@ func (h *GameHandler) HandleVote(c *gin.Context) {
 		return
 	}
 
-	userID := c.MustGet("userID").(string)
-
-	var game model.Game
-	if err := h.db.First(&game, req.GameID).Error; err != nil {
+	game, err := h.vote(c.MustGet("userID").(string), req.GameID, req.Vote)
+	switch {
+	case errors.Is(err, errGameNotFound):
 		c.JSON(http.StatusNotFound, gin.H{"error": "game not found"})
 		return
-	}
-
-	tx := h.db.Begin()
-	// defer func() {
-	// 	if r := recover(); r != nil {
-	// 		tx.Rollback()
-	// 	}
-	// }()
-	// if err := tx.Commit().Error; err != nil {
-	// 	c.JSON(http.StatusInternalServerError, gin.H{"error": "commit failed"})
-	// 	return
-	// }
-
-	updateField := ""
-	switch {
-	case game.Sender == userID && game.Svote == 0:
-		updateField = "svote"
-	case game.Receiver == userID && game.Rvote == 0:
-		updateField = "rvote"
-	default:
+	case errors.Is(err, errInvalidVote):
 		c.JSON(http.StatusForbidden, gin.H{"error": "invalid vote operation"})
 		return
-	}
-
-	if err := tx.Model(&game).Update(updateField, req.Vote).Error; err != nil {
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "vote failed"})
 		return
 	}
 
-	// Check if both voted
-	if game.Svote != 0 && game.Rvote != 0 {
-		h.calculateScores(tx, &game)
-		if err := tx.Model(&game).Update("status", "closed").Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to close game"})
-			return
+	c.JSON(http.StatusOK, game)
+}
+
+// vote casts the vote of userID in the current round of the game, finishes
+// the round once both players voted and notifies them. Bots vote through it
+// as well.
+func (h *GameHandler) vote(userID string, gameID uint, vote int) (*model.Game, error) {
+	var game model.Game
+	var round *model.Round
+	outcome := roundLost
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&game, gameID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errGameNotFound
+			}
+			return err
+		}
+
+		updateField := ""
+		switch userID {
+		case game.Sender:
+			updateField = "svote"
+		case game.Receiver:
+			updateField = "rvote"
+		default:
+			return errInvalidVote
+		}
+
+		// the vote only lands if nobody voted for this player in the current
+		// round or closed the game since it was read
+		result := tx.Model(&model.Game{}).
+			Where("id = ? AND status = ? AND round = ? AND "+updateField+" = 0", game.ID, model.GameStatusOpen, game.Round).
+			Update(updateField, vote)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidVote
+		}
+
+		if err := tx.First(&game, game.ID).Error; err != nil {
+			return err
 		}
 
+		// Check if both voted
+		if game.Svote != 0 && game.Rvote != 0 {
+			var err error
+			outcome, round, err = h.finishRound(tx, &game, game.Svote, game.Rvote, false)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch outcome {
+	case roundNext:
+		h.scheduleTimeout(game.ID, game.Deadline)
+
+		notification := gin.H{
+			"type":  "game_round",
+			"game":  newGameResponse(&game),
+			"round": newRoundResponse(round),
+		}
+		h.sendGameNotification(game.Sender, notification)
+		h.sendGameNotification(game.Receiver, notification)
+		h.playBots(&game)
+	case roundClosed:
 		// Notify both players
 		h.sendGameNotification(game.Sender, gin.H{
-			"type": "game_result",
-			"game": game,
+			"type":  "game_result",
+			"game":  game,
+			"round": newRoundResponse(round),
 		})
 		h.sendGameNotification(game.Receiver, gin.H{
-			"type": "game_result",
-			"game": game,
+			"type":  "game_result",
+			"game":  game,
+			"round": newRoundResponse(round),
 		})
+		if game.TournamentID != 0 {
+			h.tournamentMatchDone(&game)
+		}
 	}
+	return &game, nil
+}
 
-	tx.Commit()
-	c.JSON(http.StatusOK, game)
+// roundOutcome tells what finishing a round did to the game
+type roundOutcome int
+
+const (
+	roundLost   roundOutcome = iota // the round was finished by someone else
+	roundNext                       // the game goes on with the next round
+	roundClosed                     // the game is over and scored
+)
+
+// finishRound records the current round with the final votes, then starts
+// the next round or, after the last one or a timeout, closes the game and
+// credits the points of all rounds. The update only matches while the game is
+// in the round with the votes it was read with, so every round is finished
+// once and roundLost is returned to everyone who lost the race. The round is
+// nil when nobody voted in it.
+func (h *GameHandler) finishRound(tx *gorm.DB, game *model.Game, svote, rvote int, timedOut bool) (roundOutcome, *model.Round, error) {
+	now := time.Now()
+	var round *model.Round
+	if sscore, rscore, ok := gameMatrix(game).Scores(svote, rvote); ok {
+		round = &model.Round{
+			GameID:    game.ID,
+			Number:    game.Round,
+			Svote:     svote,
+			Rvote:     rvote,
+			Sscore:    sscore,
+			Rscore:    rscore,
+			TimedOut:  timedOut,
+			CreatedAt: now.Unix(),
+		}
+	}
+
+	last := timedOut || game.Round >= game.Rounds || rand.Float64() < game.StopProbability
+	updates := map[string]interface{}{"svote": svote, "rvote": rvote}
+	if round != nil {
+		updates["sscore"] = game.Sscore + round.Sscore
+		updates["rscore"] = game.Rscore + round.Rscore
+	}
+	if last {
+		updates["status"] = model.GameStatusClosed
+		updates["closed_at"] = now.Unix()
+	} else {
+		updates["round"] = game.Round + 1
+		updates["svote"], updates["rvote"] = 0, 0
+		updates["deadline"] = now.Add(time.Duration(game.Timeout) * time.Second).Unix()
+	}
+
+	result := tx.Model(&model.Game{}).
+		Where("id = ? AND status = ? AND round = ? AND svote = ? AND rvote = ?", game.ID, model.GameStatusOpen, game.Round, game.Svote, game.Rvote).
+		Updates(updates)
+	if result.Error != nil {
+		return roundLost, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return roundLost, nil, nil
+	}
+
+	if round != nil {
+		if err := tx.Create(round).Error; err != nil {
+			return roundLost, nil, err
+		}
+	}
+	played := round != nil || game.Round > 1
+	if err := tx.First(game, game.ID).Error; err != nil {
+		return roundLost, nil, err
+	}
+	if !last {
+		return roundNext, round, nil
+	}
+
+	// a game without a single played round isn't scored
+	if played {
+		if err := h.calculateScores(tx, game); err != nil {
+			return roundLost, nil, err
+		}
+		if err := h.rateGame(tx, game); err != nil {
+			return roundLost, nil, err
+		}
+		if game.TournamentID != 0 {
+			if err := h.recordTournamentGame(tx, game); err != nil {
+				return roundLost, nil, err
+			}
+		}
+	}
+	return roundClosed, round, nil
+}
+
+// AcceptInvite opens a pending game, the receiver's timeout starts now
+func (h *GameHandler) AcceptInvite(c *gin.Context) {
+	h.answerInvite(c, true, model.GameStatusOpen, "game_accepted")
 }
 
-// GetActiveGames returns current user's active games
+// DeclineInvite lets the receiver turn down a pending game
+func (h *GameHandler) DeclineInvite(c *gin.Context) {
+	h.answerInvite(c, true, model.GameStatusDeclined, "game_declined")
+}
+
+// CancelInvite lets the sender take back a pending game
+func (h *GameHandler) CancelInvite(c *gin.Context) {
+	h.answerInvite(c, false, model.GameStatusCancelled, "game_cancelled")
+}
+
+func (h *GameHandler) answerInvite(c *gin.Context, byReceiver bool, status, event string) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "game not found"})
+		return
+	}
+
+	game, err := h.answer(c.MustGet("userID").(string), uint(id), byReceiver, status, event)
+	switch {
+	case errors.Is(err, errGameNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "game not found"})
+		return
+	case errors.Is(err, errInvalidGameOp):
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid game operation"})
+		return
+	case errors.Is(err, errNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": "invite is not pending"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update game"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newGameResponse(game))
+}
+
+var (
+	errInvalidGameOp = errors.New("invalid game operation")
+	errNotPending    = errors.New("invite is not pending")
+)
+
+// answer moves a pending game to status and notifies the other player.
+// Only the receiver (byReceiver) or the sender may do it; the update only
+// matches pending games, so an invite is answered once.
+func (h *GameHandler) answer(userID string, gameID uint, byReceiver bool, status, event string) (*model.Game, error) {
+	var game model.Game
+	if err := h.db.Where("id = ? AND (sender = ? OR receiver = ?)", gameID, userID, userID).
+		First(&game).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errGameNotFound
+		}
+		return nil, err
+	}
+	if (game.Receiver == userID) != byReceiver {
+		return nil, errInvalidGameOp
+	}
+
+	updates := map[string]interface{}{"status": status}
+	if status == model.GameStatusOpen {
+		updates["deadline"] = time.Now().Add(time.Duration(game.Timeout) * time.Second).Unix()
+	}
+	result := h.db.Model(&model.Game{}).
+		Where("id = ? AND status = ?", game.ID, model.GameStatusPending).
+		Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errNotPending
+	}
+	if err := h.db.First(&game, game.ID).Error; err != nil {
+		return nil, err
+	}
+
+	other := game.Sender
+	if !byReceiver {
+		other = game.Receiver
+	}
+	h.sendGameNotification(other, gin.H{
+		"type": event,
+		"game": newGameResponse(&game),
+	})
+
+	if game.Status == model.GameStatusOpen {
+		h.scheduleTimeout(game.ID, game.Deadline)
+		h.playBots(&game)
+	}
+	return &game, nil
+}
+
+// GetRounds returns the finished rounds of a game to its players
+func (h *GameHandler) GetRounds(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	var game model.Game
+	if err := h.db.Where("id = ? AND (sender = ? OR receiver = ?)", c.Param("id"), userID, userID).
+		First(&game).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "game not found"})
+		return
+	}
+
+	var rounds []model.Round
+	if err := h.db.Where("game_id = ?", game.ID).Order("number").Find(&rounds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch rounds"})
+		return
+	}
+
+	response := make([]RoundResponse, len(rounds))
+	for i := range rounds {
+		response[i] = newRoundResponse(&rounds[i])
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"game":   newGameResponse(&game),
+		"rounds": response,
+	})
+}
+
+// GetGameTypes lists the game types an invite can choose
+func (h *GameHandler) GetGameTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, payoff.Types())
+}
+
+// GetActiveGames returns current user's pending and open games
 func (h *GameHandler) GetActiveGames(c *gin.Context) {
 	userID := c.MustGet("userID").(string)
 
 	var games []model.Game
-	result := h.db.Where("(sender = ? OR receiver = ?) AND status = 'open'", userID, userID).Find(&games)
+	result := h.db.Where("(sender = ? OR receiver = ?) AND status IN ?", userID, userID,
+		[]string{model.GameStatusPending, model.GameStatusOpen}).Find(&games)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch games"})
 		return
 	}
 
 	response := make([]GameResponse, len(games))
-	for i, game := range games {
-		response[i] = GameResponse{
-			ID:       game.ID,
-			Sender:   game.Sender,
-			Receiver: game.Receiver,
-			Created:  game.Created,
-			Status:   game.Status,
-		}
+	for i := range games {
+		response[i] = newGameResponse(&games[i])
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
-func (h *GameHandler) calculateScores(tx *gorm.DB, game *model.Game) {
-	var senderScore, receiverScore int
-
-	switch {
-	case game.Svote == 1 && game.Rvote == -1:
-		senderScore, receiverScore = 0, 5
-	case game.Svote == -1 && game.Rvote == 1:
-		senderScore, receiverScore = 5, 0
-	case game.Svote == 1 && game.Rvote == 1:
-		senderScore, receiverScore = 3, 3
-	case game.Svote == -1 && game.Rvote == -1:
-		senderScore, receiverScore = 1, 1
-	}
-
-	tx.Exec(`
-		INSERT INTO results (user_id, score, last_updated,)
+// calculateScores credits the points of all rounds to the players
+func (h *GameHandler) calculateScores(tx *gorm.DB, game *model.Game) error {
+	now := time.Now()
+	return tx.Exec(`
+		INSERT INTO results (user_id, score, last_updated)
 		VALUES (?, ?, ?), (?, ?, ?)
 		ON CONFLICT (user_id) DO UPDATE SET
 			score = results.score + EXCLUDED.score,
 			last_updated = EXCLUDED.last_updated
 	`,
-		game.Sender, senderScore, time.Now(),
-		game.Receiver, receiverScore, time.Now())
+		game.Sender, game.Sscore, now,
+		game.Receiver, game.Rscore, now).Error
 }
 
 func (h *GameHandler) sendGameNotification(userID string, data interface{}) {
-	h.hub.mutex.RLock()
-	defer h.hub.mutex.RUnlock()
-
-	if client, ok := h.hub.clients[userID]; ok {
-		client.Conn.WriteJSON(data)
+	if client, ok := h.hub.client(userID); ok {
+		client.WriteJSON(data)
 	}
 }
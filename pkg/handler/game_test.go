@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"halves/pkg/model"
+	"halves/pkg/payoff"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestGameHandler(t *testing.T) *GameHandler {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Game{}, &model.Round{}, &model.Result{},
+		&model.RatingChange{}, &model.Tournament{}, &model.TournamentPlayer{}, &model.Season{}, &model.SeasonStanding{}))
+	return NewGameHandler(db, NewHub())
+}
+
+// createOpenGame stores an accepted game between alice and bob
+func createOpenGame(t *testing.T, h *GameHandler, rounds int) model.Game {
+	game, err := GameOptions{Rounds: rounds}.newGame("alice", "bob")
+	require.NoError(t, err)
+	game.Status = model.GameStatusOpen
+	game.Deadline = time.Now().Add(time.Hour).Unix()
+	require.NoError(t, h.db.Create(&game).Error)
+	return game
+}
+
+func TestVoteRace(t *testing.T) {
+	h := newTestGameHandler(t)
+	game := createOpenGame(t, h, 1)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	voted := 0
+	for i := 0; i < 4; i++ {
+		for _, player := range []string{"alice", "bob"} {
+			wg.Add(1)
+			go func(player string) {
+				defer wg.Done()
+				_, err := h.vote(player, game.ID, payoff.Defect)
+				if err != nil {
+					assert.ErrorIs(t, err, errInvalidVote)
+					return
+				}
+				mutex.Lock()
+				voted++
+				mutex.Unlock()
+			}(player)
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, 2, voted)
+
+	var rounds []model.Round
+	require.NoError(t, h.db.Where("game_id = ?", game.ID).Find(&rounds).Error)
+	require.Len(t, rounds, 1)
+	require.NoError(t, h.db.First(&game, game.ID).Error)
+	assert.Equal(t, model.GameStatusClosed, game.Status)
+	assert.Equal(t, rounds[0].Sscore, game.Sscore)
+
+	// the points and the rating are credited once
+	var results []model.Result
+	require.NoError(t, h.db.Order("user_id").Find(&results).Error)
+	require.Len(t, results, 2)
+	assert.Equal(t, game.Sscore, results[0].Score)
+	assert.Equal(t, game.Rscore, results[1].Score)
+	assert.Equal(t, 1, results[0].RatedGames)
+	var changes int64
+	require.NoError(t, h.db.Model(&model.RatingChange{}).Count(&changes).Error)
+	assert.EqualValues(t, 2, changes)
+}
+
+func TestExpireGameRacesFinalVote(t *testing.T) {
+	h := newTestGameHandler(t)
+
+	total := 0
+	for i := 0; i < 20; i++ {
+		game := createOpenGame(t, h, 1)
+		require.NoError(t, h.db.Model(&game).Updates(map[string]interface{}{
+			"rvote":    payoff.Cooperate,
+			"deadline": time.Now().Add(-time.Second).Unix(),
+		}).Error)
+
+		var wg sync.WaitGroup
+		var voteErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, voteErr = h.vote("alice", game.ID, payoff.Defect)
+		}()
+		go func() {
+			defer wg.Done()
+			h.expireGame(game.ID)
+		}()
+		wg.Wait()
+
+		var rounds []model.Round
+		require.NoError(t, h.db.Where("game_id = ?", game.ID).Find(&rounds).Error)
+		require.Len(t, rounds, 1)
+		if voteErr == nil {
+			// the vote closed the game, the timeout found nothing to do
+			assert.False(t, rounds[0].TimedOut)
+			assert.Equal(t, payoff.Defect, rounds[0].Svote)
+		} else {
+			// the timeout upvoted for alice, her vote came too late
+			assert.ErrorIs(t, voteErr, errInvalidVote)
+			assert.True(t, rounds[0].TimedOut)
+			assert.Equal(t, payoff.Cooperate, rounds[0].Svote)
+		}
+
+		require.NoError(t, h.db.First(&game, game.ID).Error)
+		assert.Equal(t, model.GameStatusClosed, game.Status)
+		assert.Equal(t, rounds[0].Sscore, game.Sscore)
+		total += game.Sscore
+	}
+
+	var result model.Result
+	require.NoError(t, h.db.First(&result, "user_id = ?", "alice").Error)
+	assert.Equal(t, total, result.Score)
+	assert.Equal(t, 20, result.RatedGames)
+}
+
+func TestVoteAdvancesRounds(t *testing.T) {
+	h := newTestGameHandler(t)
+	game := createOpenGame(t, h, 3)
+
+	votes := []int{payoff.Cooperate, payoff.Defect, payoff.Cooperate}
+	sscore := 0
+	for i, svote := range votes {
+		_, err := h.vote("alice", game.ID, svote)
+		require.NoError(t, err)
+		updated, err := h.vote("bob", game.ID, payoff.Cooperate)
+		require.NoError(t, err)
+
+		points, _, _ := gameMatrix(updated).Scores(svote, payoff.Cooperate)
+		sscore += points
+		assert.Equal(t, sscore, updated.Sscore)
+		if i < len(votes)-1 {
+			// the next round starts without votes
+			assert.Equal(t, model.GameStatusOpen, updated.Status)
+			assert.Equal(t, i+2, updated.Round)
+			assert.Zero(t, updated.Svote)
+			assert.Zero(t, updated.Rvote)
+			var results int64
+			require.NoError(t, h.db.Model(&model.Result{}).Count(&results).Error)
+			assert.Zero(t, results, "points are credited when the game closes")
+		} else {
+			assert.Equal(t, model.GameStatusClosed, updated.Status)
+			assert.Equal(t, 3, updated.Round)
+			assert.NotZero(t, updated.ClosedAt)
+		}
+	}
+
+	var rounds []model.Round
+	require.NoError(t, h.db.Where("game_id = ?", game.ID).Order("number").Find(&rounds).Error)
+	require.Len(t, rounds, 3)
+	for i, round := range rounds {
+		assert.Equal(t, i+1, round.Number)
+		assert.Equal(t, votes[i], round.Svote)
+	}
+
+	// the game is over, no fourth round
+	_, err := h.vote("alice", game.ID, payoff.Cooperate)
+	assert.ErrorIs(t, err, errInvalidVote)
+
+	var result model.Result
+	require.NoError(t, h.db.First(&result, "user_id = ?", "alice").Error)
+	assert.Equal(t, sscore, result.Score)
+}
+
+// createInvite stores a pending invite from alice to bob
+func createInvite(t *testing.T, h *GameHandler) model.Game {
+	game, err := GameOptions{}.newGame("alice", "bob")
+	require.NoError(t, err)
+	require.NoError(t, h.db.Create(&game).Error)
+	return game
+}
+
+func TestAcceptInvite(t *testing.T) {
+	h := newTestGameHandler(t)
+	invite := createInvite(t, h)
+
+	_, err := h.answer("carol", invite.ID, true, model.GameStatusOpen, "game_accepted")
+	assert.ErrorIs(t, err, errGameNotFound)
+	_, err = h.answer("alice", invite.ID, true, model.GameStatusOpen, "game_accepted")
+	assert.ErrorIs(t, err, errInvalidGameOp, "only the receiver accepts")
+
+	game, err := h.answer("bob", invite.ID, true, model.GameStatusOpen, "game_accepted")
+	require.NoError(t, err)
+	assert.Equal(t, model.GameStatusOpen, game.Status)
+	// the round timeout starts with the accept
+	assert.InDelta(t, time.Now().Unix()+game.Timeout, game.Deadline, 2)
+
+	_, err = h.answer("bob", invite.ID, true, model.GameStatusOpen, "game_accepted")
+	assert.ErrorIs(t, err, errNotPending)
+	_, err = h.answer("alice", invite.ID, false, model.GameStatusCancelled, "game_cancelled")
+	assert.ErrorIs(t, err, errNotPending)
+}
+
+func TestDeclineInvite(t *testing.T) {
+	h := newTestGameHandler(t)
+	invite := createInvite(t, h)
+
+	game, err := h.answer("bob", invite.ID, true, model.GameStatusDeclined, "game_declined")
+	require.NoError(t, err)
+	assert.Equal(t, model.GameStatusDeclined, game.Status)
+	assert.Equal(t, invite.Deadline, game.Deadline)
+
+	_, err = h.answer("bob", invite.ID, true, model.GameStatusOpen, "game_accepted")
+	assert.ErrorIs(t, err, errNotPending)
+	_, err = h.vote("bob", invite.ID, payoff.Cooperate)
+	assert.ErrorIs(t, err, errInvalidVote)
+}
+
+func TestExpireInvite(t *testing.T) {
+	h := newTestGameHandler(t)
+	invite := createInvite(t, h)
+
+	// nothing happens before the deadline
+	h.expireGame(invite.ID)
+	var game model.Game
+	require.NoError(t, h.db.First(&game, invite.ID).Error)
+	assert.Equal(t, model.GameStatusPending, game.Status)
+
+	require.NoError(t, h.db.Model(&game).Update("deadline", time.Now().Add(-time.Second).Unix()).Error)
+	h.expireGame(invite.ID)
+	require.NoError(t, h.db.First(&game, invite.ID).Error)
+	assert.Equal(t, model.GameStatusExpired, game.Status)
+	assert.Zero(t, game.ClosedAt)
+
+	_, err := h.answer("bob", invite.ID, true, model.GameStatusOpen, "game_accepted")
+	assert.ErrorIs(t, err, errNotPending)
+
+	// an expired invite isn't played or scored
+	var rounds, results int64
+	require.NoError(t, h.db.Model(&model.Round{}).Count(&rounds).Error)
+	require.NoError(t, h.db.Model(&model.Result{}).Count(&results).Error)
+	assert.Zero(t, rounds)
+	assert.Zero(t, results)
+}
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"halves/pkg/model"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Outcomes of a closed game for one player
+const (
+	outcomeWin  = "win"
+	outcomeLoss = "loss"
+	outcomeDraw = "draw"
+)
+
+// HistoryEntry is a finished game seen by one of its players
+type HistoryEntry struct {
+	GameResponse
+	Opponent string `json:"opponent"`
+	Outcome  string `json:"outcome,omitempty"` // only for played games
+}
+
+// finishedStatuses are the statuses of games that can't change any more
+var finishedStatuses = []string{
+	model.GameStatusClosed,
+	model.GameStatusDeclined,
+	model.GameStatusCancelled,
+	model.GameStatusExpired,
+}
+
+// played matches closed games with at least one played round, the others
+// have no outcome
+const played = "status = 'closed' AND EXISTS (SELECT 1 FROM rounds WHERE rounds.game_id = games.id)"
+
+// playedGames selects the played games of @id as the user's points (mine),
+// the opponent's (theirs) and the opponent
+const playedGames = `
+	SELECT
+		CASE WHEN sender = @id THEN sscore ELSE rscore END AS mine,
+		CASE WHEN sender = @id THEN rscore ELSE sscore END AS theirs,
+		CASE WHEN sender = @id THEN receiver ELSE sender END AS opponent
+	FROM games
+	WHERE (sender = @id OR receiver = @id) AND ` + played
+
+// GetHistory returns the finished games of the current user, newest first.
+// Filters: ?opponent=, ?outcome=win|loss|draw, ?from= and ?to= (Unix
+// timestamps of creation); paging with ?limit= and ?before=<game id>.
+func (h *GameHandler) GetHistory(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+
+	args := map[string]interface{}{"id": userID}
+	query := h.db.Where("(sender = @id OR receiver = @id)", args).
+		Where("status IN ?", finishedStatuses).
+		Order("id DESC").
+		Limit(limit)
+	if before := c.Query("before"); before != "" {
+		query = query.Where("id < ?", before)
+	}
+	if opponent := c.Query("opponent"); opponent != "" {
+		query = query.Where("(sender = ? OR receiver = ?)", opponent, opponent)
+	}
+	for _, bound := range []struct{ param, cond string }{{"from", "created >= ?"}, {"to", "created < ?"}} {
+		if v := c.Query(bound.param); v != "" {
+			ts, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid timestamp format"})
+				return
+			}
+			query = query.Where(bound.cond, time.Unix(ts, 0))
+		}
+	}
+	switch outcome := c.Query("outcome"); outcome {
+	case "":
+	case outcomeWin:
+		query = query.Where(played+" AND ((sender = @id AND sscore > rscore) OR (receiver = @id AND rscore > sscore))", args)
+	case outcomeLoss:
+		query = query.Where(played+" AND ((sender = @id AND sscore < rscore) OR (receiver = @id AND rscore < sscore))", args)
+	case outcomeDraw:
+		query = query.Where(played + " AND sscore = rscore")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "outcome must be win, loss or draw"})
+		return
+	}
+
+	var games []model.Game
+	if err := query.Find(&games).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch games"})
+		return
+	}
+
+	ids := make([]uint, len(games))
+	for i := range games {
+		ids[i] = games[i].ID
+	}
+	var playedIDs []uint
+	if err := h.db.Model(&model.Round{}).Distinct("game_id").Where("game_id IN ?", ids).
+		Pluck("game_id", &playedIDs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch games"})
+		return
+	}
+	wasPlayed := make(map[uint]bool, len(playedIDs))
+	for _, id := range playedIDs {
+		wasPlayed[id] = true
+	}
+
+	entries := make([]HistoryEntry, len(games))
+	for i := range games {
+		game := &games[i]
+		entry := HistoryEntry{GameResponse: newGameResponse(game), Opponent: game.Sender}
+		mine, theirs := game.Rscore, game.Sscore
+		if game.Sender == userID {
+			entry.Opponent = game.Receiver
+			mine, theirs = theirs, mine
+		}
+		if game.Status == model.GameStatusClosed && wasPlayed[game.ID] {
+			entry.Outcome = outcomeOf(mine, theirs)
+		}
+		entries[i] = entry
+	}
+
+	response := gin.H{"games": entries}
+	if len(games) == limit {
+		response["next_before"] = games[len(games)-1].ID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func outcomeOf(mine, theirs int) string {
+	switch {
+	case mine > theirs:
+		return outcomeWin
+	case mine < theirs:
+		return outcomeLoss
+	default:
+		return outcomeDraw
+	}
+}
+
+// Record is the win/loss/draw count over a set of games
+type Record struct {
+	Games  int `json:"games"`
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+	Draws  int `json:"draws"`
+	Points int `json:"points"`
+}
+
+// HeadToHead is the record of a user against one opponent
+type HeadToHead struct {
+	Opponent string `json:"opponent"`
+	Record
+	OpponentPoints int `json:"opponent_points"`
+}
+
+// GetUserStats returns the statistics of a user over their played games:
+// win/loss/draw counts, cooperation rate and average payoff per round, and
+// the records against the 50 most frequent opponents
+func (h *GameHandler) GetUserStats(c *gin.Context) {
+	userID := c.Param("id")
+
+	var user model.User
+	if err := h.db.Select("id").Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	args := map[string]interface{}{"id": userID}
+
+	var total Record
+	if err := h.db.Raw(`
+		SELECT COUNT(*) AS games,
+			COALESCE(SUM(CASE WHEN mine > theirs THEN 1 ELSE 0 END), 0) AS wins,
+			COALESCE(SUM(CASE WHEN mine < theirs THEN 1 ELSE 0 END), 0) AS losses,
+			COALESCE(SUM(CASE WHEN mine = theirs THEN 1 ELSE 0 END), 0) AS draws,
+			COALESCE(SUM(mine), 0) AS points
+		FROM (`+playedGames+`) AS played`, args).Scan(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch stats"})
+		return
+	}
+
+	var rounds struct {
+		Rounds       int
+		Cooperations int
+		Points       int
+	}
+	if err := h.db.Raw(`
+		SELECT COUNT(*) AS rounds,
+			COALESCE(SUM(CASE WHEN (g.sender = @id AND r.svote = 1) OR (g.receiver = @id AND r.rvote = 1) THEN 1 ELSE 0 END), 0) AS cooperations,
+			COALESCE(SUM(CASE WHEN g.sender = @id THEN r.sscore ELSE r.rscore END), 0) AS points
+		FROM rounds r JOIN games g ON g.id = r.game_id
+		WHERE g.status = 'closed' AND (g.sender = @id OR g.receiver = @id)`, args).Scan(&rounds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch stats"})
+		return
+	}
+
+	headToHead := []HeadToHead{}
+	if err := h.db.Raw(`
+		SELECT opponent, COUNT(*) AS games,
+			SUM(CASE WHEN mine > theirs THEN 1 ELSE 0 END) AS wins,
+			SUM(CASE WHEN mine < theirs THEN 1 ELSE 0 END) AS losses,
+			SUM(CASE WHEN mine = theirs THEN 1 ELSE 0 END) AS draws,
+			SUM(mine) AS points,
+			SUM(theirs) AS opponent_points
+		FROM (`+playedGames+`) AS played
+		GROUP BY opponent
+		ORDER BY games DESC, opponent
+		LIMIT 50`, args).Scan(&headToHead).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch stats"})
+		return
+	}
+
+	var cooperationRate, averagePayoff float64
+	if rounds.Rounds > 0 {
+		cooperationRate = float64(rounds.Cooperations) / float64(rounds.Rounds)
+		averagePayoff = float64(rounds.Points) / float64(rounds.Rounds)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":          userID,
+		"games":            total.Games,
+		"wins":             total.Wins,
+		"losses":           total.Losses,
+		"draws":            total.Draws,
+		"points":           total.Points,
+		"rounds":           rounds.Rounds,
+		"cooperation_rate": cooperationRate,
+		"average_payoff":   averagePayoff,
+		"head_to_head":     headToHead,
+	})
+}
@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"errors"
+	"halves/pkg/leaderboard"
+	"halves/pkg/model"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const leaderboardSize = 100
+
+// windowStandings ranks the players by their played games closed in
+// [@from, @to): points, then wins
+const windowStandings = `
+	SELECT user_id, COUNT(*) AS games,
+		SUM(CASE WHEN mine > theirs THEN 1 ELSE 0 END) AS wins,
+		SUM(CASE WHEN mine < theirs THEN 1 ELSE 0 END) AS losses,
+		SUM(CASE WHEN mine = theirs THEN 1 ELSE 0 END) AS draws,
+		SUM(mine) AS points
+	FROM (
+		SELECT sender AS user_id, sscore AS mine, rscore AS theirs FROM games
+		WHERE ` + played + ` AND closed_at >= @from AND closed_at < @to
+		UNION ALL
+		SELECT receiver, rscore, sscore FROM games
+		WHERE ` + played + ` AND closed_at >= @from AND closed_at < @to
+	) AS played
+	GROUP BY user_id
+	ORDER BY points DESC, wins DESC, user_id`
+
+// SeasonResponse is a season with its live or, once finished, archived
+// standings
+type SeasonResponse struct {
+	ID         uint               `json:"id"`
+	Name       string             `json:"name"`
+	StartsAt   int64              `json:"starts_at"`
+	EndsAt     int64              `json:"ends_at"`
+	Status     string             `json:"status"`
+	CreatedAt  int64              `json:"created_at"`
+	FinishedAt int64              `json:"finished_at"`
+	Standings  []StandingResponse `json:"standings,omitempty"`
+}
+
+func newSeasonResponse(s *model.Season) SeasonResponse {
+	return SeasonResponse{
+		ID:         s.ID,
+		Name:       s.Name,
+		StartsAt:   s.StartsAt,
+		EndsAt:     s.EndsAt,
+		Status:     s.Status,
+		CreatedAt:  s.CreatedAt,
+		FinishedAt: s.FinishedAt,
+	}
+}
+
+// standings computes the standings over [from, to), the top ones only when
+// limit > 0
+func standings(db *gorm.DB, from, to int64, limit int) ([]StandingResponse, error) {
+	query := windowStandings
+	if limit > 0 {
+		query += " LIMIT " + strconv.Itoa(limit)
+	}
+	out := []StandingResponse{}
+	if err := db.Raw(query, map[string]interface{}{"from": from, "to": to}).Scan(&out).Error; err != nil {
+		return nil, err
+	}
+	rankStandings(out)
+	return out, nil
+}
+
+// rankStandings numbers sorted standings; equal points and wins share a rank
+func rankStandings(s []StandingResponse) {
+	for i := range s {
+		s[i].Rank = i + 1
+		if i > 0 && s[i-1].Points == s[i].Points && s[i-1].Wins == s[i].Wins {
+			s[i].Rank = s[i-1].Rank
+		}
+	}
+}
+
+// GetLeaderboard returns the top 100 of the day, week or month (UTC) by
+// points of the games closed in it, or of all time. ?at=<Unix timestamp>
+// picks a past window, the current one by default.
+func (h *ReslutHandler) GetLeaderboard(c *gin.Context) {
+	period := c.DefaultQuery("period", leaderboard.AllTime)
+	at := time.Now()
+	if v := c.Query("at"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid timestamp format"})
+			return
+		}
+		at = time.Unix(ts, 0)
+	}
+	from, to, err := leaderboard.Window(period, at)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := standings(h.db, from, to, leaderboardSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch leaderboard"})
+		return
+	}
+	response := gin.H{"period": period, "standings": entries}
+	if period != leaderboard.AllTime {
+		response["from"], response["to"] = from, to
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateSeason schedules a named season (admins only)
+func (h *ReslutHandler) CreateSeason(c *gin.Context) {
+	var req struct {
+		Name     string `json:"name" binding:"required,max=100"`
+		StartsAt int64  `json:"starts_at" binding:"required"`
+		EndsAt   int64  `json:"ends_at" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now().Unix()
+	if req.EndsAt <= req.StartsAt || req.EndsAt <= now {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at and in the future"})
+		return
+	}
+
+	season := model.Season{
+		Name:      req.Name,
+		StartsAt:  req.StartsAt,
+		EndsAt:    req.EndsAt,
+		Status:    model.SeasonRunning,
+		CreatedBy: c.MustGet("userID").(string),
+		CreatedAt: now,
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var clashes int64
+		if err := tx.Model(&model.Season{}).
+			Where("name = ? OR (starts_at < ? AND ends_at > ?)", req.Name, req.EndsAt, req.StartsAt).
+			Count(&clashes).Error; err != nil {
+			return err
+		}
+		if clashes > 0 {
+			return errSeasonClash
+		}
+		return tx.Create(&season).Error
+	})
+	if errors.Is(err, errSeasonClash) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create season"})
+		return
+	}
+
+	h.scheduleSeasonEnd(season.ID, season.EndsAt)
+	c.JSON(http.StatusCreated, newSeasonResponse(&season))
+}
+
+var errSeasonClash = errors.New("a season with this name or overlapping dates exists")
+
+// EndSeason ends a running season now and archives its standings (admins
+// only)
+func (h *ReslutHandler) EndSeason(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "season not found"})
+		return
+	}
+
+	now := time.Now().Unix()
+	result := h.db.Model(&model.Season{}).
+		Where("id = ? AND status = ? AND starts_at <= ? AND ends_at > ?", id, model.SeasonRunning, now, now).
+		Update("ends_at", now)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to end season"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "season is not in progress"})
+		return
+	}
+
+	if err := h.archiveSeason(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to archive season"})
+		return
+	}
+	h.GetSeason(c)
+}
+
+// GetSeasons lists the seasons, newest first, ?status= filters
+func (h *ReslutHandler) GetSeasons(c *gin.Context) {
+	query := h.db.Order("starts_at DESC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var seasons []model.Season
+	if err := query.Find(&seasons).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch seasons"})
+		return
+	}
+	response := make([]SeasonResponse, len(seasons))
+	for i := range seasons {
+		response[i] = newSeasonResponse(&seasons[i])
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetSeason returns a season with the top 100: live while it runs, the
+// archived final standings after it ended
+func (h *ReslutHandler) GetSeason(c *gin.Context) {
+	var season model.Season
+	if err := h.db.Where("id = ?", c.Param("id")).First(&season).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "season not found"})
+		return
+	}
+
+	response := newSeasonResponse(&season)
+	if season.Status == model.SeasonFinished {
+		var archived []model.SeasonStanding
+		if err := h.db.Where("season_id = ?", season.ID).
+			Order("rank, user_id").Limit(leaderboardSize).
+			Find(&archived).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch season"})
+			return
+		}
+		response.Standings = make([]StandingResponse, len(archived))
+		for i, s := range archived {
+			response.Standings[i] = StandingResponse{
+				UserID: s.UserID,
+				Rank:   s.Rank,
+				Games:  s.Games,
+				Wins:   s.Wins,
+				Losses: s.Losses,
+				Draws:  s.Draws,
+				Points: s.Points,
+			}
+		}
+	} else {
+		live, err := standings(h.db, season.StartsAt, season.EndsAt, leaderboardSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch season"})
+			return
+		}
+		response.Standings = live
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *ReslutHandler) scheduleSeasonEnd(seasonID uint, endsAt int64) {
+	time.AfterFunc(time.Until(time.Unix(endsAt, 0)), func() {
+		if err := h.archiveSeason(seasonID); err != nil {
+			log.Printf("Failed to archive season %d: %v", seasonID, err)
+		}
+	})
+}
+
+// archiveSeason finishes a season that reached its end and stores the final
+// standings of every player; it does nothing for any other season, so it
+// runs once per season
+func (h *ReslutHandler) archiveSeason(seasonID uint) error {
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		var season model.Season
+		if err := tx.First(&season, seasonID).Error; err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		result := tx.Model(&model.Season{}).
+			Where("id = ? AND status = ? AND ends_at <= ?", seasonID, model.SeasonRunning, now).
+			Updates(map[string]interface{}{"status": model.SeasonFinished, "finished_at": now})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		final, err := standings(tx, season.StartsAt, season.EndsAt, 0)
+		if err != nil || len(final) == 0 {
+			return err
+		}
+		rows := make([]model.SeasonStanding, len(final))
+		for i, s := range final {
+			rows[i] = model.SeasonStanding{
+				SeasonID: seasonID,
+				UserID:   s.UserID,
+				Rank:     s.Rank,
+				Games:    s.Games,
+				Wins:     s.Wins,
+				Losses:   s.Losses,
+				Draws:    s.Draws,
+				Points:   s.Points,
+			}
+		}
+		return tx.CreateInBatches(rows, 100).Error
+	})
+}
+
+// ResumeSeasons archives the seasons that ended while the server was down
+// and schedules the end of the others
+func (h *ReslutHandler) ResumeSeasons() error {
+	var seasons []model.Season
+	if err := h.db.Where("status = ?", model.SeasonRunning).Find(&seasons).Error; err != nil {
+		return err
+	}
+	for _, s := range seasons {
+		h.scheduleSeasonEnd(s.ID, s.EndsAt)
+	}
+	return nil
+}
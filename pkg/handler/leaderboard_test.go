@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"halves/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// createPlayedGame stores a game closed at closedAt with one round
+func createPlayedGame(t *testing.T, db *gorm.DB, sender, receiver string, sscore, rscore int, closedAt int64) {
+	game := model.Game{Sender: sender, Receiver: receiver, Created: time.Unix(closedAt, 0), Status: model.GameStatusClosed,
+		Sscore: sscore, Rscore: rscore, ClosedAt: closedAt}
+	require.NoError(t, db.Create(&game).Error)
+	require.NoError(t, db.Create(&model.Round{GameID: game.ID, Number: 1, Svote: 1, Rvote: 1,
+		Sscore: sscore, Rscore: rscore, CreatedAt: closedAt}).Error)
+}
+
+func seasonStandings(t *testing.T, db *gorm.DB, seasonID uint) map[string]model.SeasonStanding {
+	var rows []model.SeasonStanding
+	require.NoError(t, db.Where("season_id = ?", seasonID).Find(&rows).Error)
+	out := make(map[string]model.SeasonStanding, len(rows))
+	for _, r := range rows {
+		out[r.UserID] = r
+	}
+	return out
+}
+
+func TestArchiveSeasonBoundary(t *testing.T) {
+	db := newTestGameHandler(t).db
+	h := NewReslutHandler(db)
+
+	// two back to back seasons that both ended
+	start := time.Now().Add(-2 * time.Hour).Unix()
+	rollover := start + 3600
+	end := rollover + 3600
+	first := model.Season{Name: "first", StartsAt: start, EndsAt: rollover, Status: model.SeasonRunning, CreatedBy: "admin"}
+	second := model.Season{Name: "second", StartsAt: rollover, EndsAt: end, Status: model.SeasonRunning, CreatedBy: "admin"}
+	require.NoError(t, db.Create(&first).Error)
+	require.NoError(t, db.Create(&second).Error)
+
+	createPlayedGame(t, db, "alice", "bob", 5, 0, start-1)    // before both
+	createPlayedGame(t, db, "alice", "bob", 3, 3, start)      // first season
+	createPlayedGame(t, db, "bob", "alice", 5, 0, rollover-1) // first season
+	createPlayedGame(t, db, "carol", "bob", 1, 1, rollover)   // second season
+	createPlayedGame(t, db, "carol", "alice", 5, 0, end)      // after both
+
+	require.NoError(t, h.archiveSeason(first.ID))
+	require.NoError(t, h.archiveSeason(second.ID))
+
+	standings := seasonStandings(t, db, first.ID)
+	require.Len(t, standings, 2)
+	assert.Equal(t, model.SeasonStanding{SeasonID: first.ID, UserID: "bob", Rank: 1, Games: 2, Wins: 1, Draws: 1, Points: 8}, standings["bob"])
+	assert.Equal(t, model.SeasonStanding{SeasonID: first.ID, UserID: "alice", Rank: 2, Games: 2, Losses: 1, Draws: 1, Points: 3}, standings["alice"])
+
+	// a game closed right at the rollover belongs to the new season only
+	standings = seasonStandings(t, db, second.ID)
+	require.Len(t, standings, 2)
+	assert.Equal(t, model.SeasonStanding{SeasonID: second.ID, UserID: "bob", Rank: 1, Games: 1, Draws: 1, Points: 1}, standings["bob"])
+	assert.Equal(t, model.SeasonStanding{SeasonID: second.ID, UserID: "carol", Rank: 1, Games: 1, Draws: 1, Points: 1}, standings["carol"])
+
+	require.NoError(t, db.First(&first, first.ID).Error)
+	assert.Equal(t, model.SeasonFinished, first.Status)
+	assert.NotZero(t, first.FinishedAt)
+
+	// archiving again keeps the standings as they are
+	require.NoError(t, h.archiveSeason(first.ID))
+	assert.Len(t, seasonStandings(t, db, first.ID), 2)
+}
+
+func TestArchiveSeasonBeforeItsEnd(t *testing.T) {
+	db := newTestGameHandler(t).db
+	h := NewReslutHandler(db)
+
+	now := time.Now().Unix()
+	season := model.Season{Name: "current", StartsAt: now - 3600, EndsAt: now + 3600, Status: model.SeasonRunning, CreatedBy: "admin"}
+	require.NoError(t, db.Create(&season).Error)
+	createPlayedGame(t, db, "alice", "bob", 3, 3, now-60)
+
+	require.NoError(t, h.archiveSeason(season.ID))
+	require.NoError(t, db.First(&season, season.ID).Error)
+	assert.Equal(t, model.SeasonRunning, season.Status)
+	assert.Empty(t, seasonStandings(t, db, season.ID))
+}
@@ -73,8 +73,8 @@ func (h *MessageHandler) SendMessage(c *gin.Context) {
 	}()
 
 	// Notify receiver via WebSocket
-	if client, ok := h.wsHub.clients[req.Receiver]; ok {
-		err := client.Conn.WriteJSON(gin.H{
+	if client, ok := h.wsHub.client(req.Receiver); ok {
+		err := client.WriteJSON(gin.H{
 			"type": "message",
 			"data": gin.H{
 				"id":        message.ID,
@@ -157,3 +157,19 @@ func (h *MessageHandler) GetMessages(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"messages": response})
 }
+
+// DeleteMessage removes a message (moderators only)
+func (h *MessageHandler) DeleteMessage(c *gin.Context) {
+	result := h.db.Where("id = ?", c.Param("id")).Delete(&model.Message{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete message"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	}
+	log.Printf("Message %s deleted by %s", c.Param("id"), c.MustGet("userID"))
+
+	c.JSON(http.StatusOK, gin.H{"message": "message deleted"})
+}
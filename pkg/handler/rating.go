@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"fmt"
+	"halves/pkg/model"
+	"halves/pkg/rating"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RatingChangeResponse is one game in the rating history of a user
+type RatingChangeResponse struct {
+	ID        uint    `json:"id"`
+	GameID    uint    `json:"game_id"`
+	Opponent  string  `json:"opponent"`
+	Before    float64 `json:"before"`
+	After     float64 `json:"after"`
+	Change    float64 `json:"change"`
+	CreatedAt int64   `json:"created_at"`
+}
+
+// rateGame updates the ratings of both players of a closed game. It runs in
+// the transaction that closes the game, after calculateScores made sure both
+// have a results row.
+func (h *GameHandler) rateGame(tx *gorm.DB, game *model.Game) error {
+	var results []model.Result
+	if err := tx.Where("user_id IN ?", []string{game.Sender, game.Receiver}).Find(&results).Error; err != nil {
+		return err
+	}
+	players := make(map[string]model.Result, len(results))
+	for _, r := range results {
+		players[r.UserID] = r
+	}
+	sender, hasSender := players[game.Sender]
+	receiver, hasReceiver := players[game.Receiver]
+	if !hasSender || !hasReceiver {
+		return fmt.Errorf("no results for the players of game %d", game.ID)
+	}
+
+	sAfter, rAfter := rating.Update(sender.Rating, receiver.Rating, sender.RatedGames, receiver.RatedGames,
+		rating.Result(game.Sscore, game.Rscore))
+	now := time.Now().Unix()
+	changes := []model.RatingChange{
+		{UserID: game.Sender, GameID: game.ID, Opponent: game.Receiver, Before: sender.Rating, After: sAfter, CreatedAt: now},
+		{UserID: game.Receiver, GameID: game.ID, Opponent: game.Sender, Before: receiver.Rating, After: rAfter, CreatedAt: now},
+	}
+	if err := tx.Create(&changes).Error; err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if err := tx.Model(&model.Result{}).Where("user_id = ?", change.UserID).
+			Updates(map[string]interface{}{
+				"rating":      change.After,
+				"rated_games": gorm.Expr("rated_games + 1"),
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetRating returns the rating of a user and its changes, newest first;
+// paging with ?limit= and ?before=<change id>
+func (h *GameHandler) GetRating(c *gin.Context) {
+	userID := c.Param("id")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+
+	var user model.User
+	if err := h.db.Select("id").Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	// users without a played game have the initial rating
+	result := model.Result{Rating: rating.Initial}
+	if err := h.db.Where("user_id = ?", userID).Limit(1).Find(&result).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch rating"})
+		return
+	}
+
+	query := h.db.Where("user_id = ?", userID).Order("id DESC").Limit(limit)
+	if before := c.Query("before"); before != "" {
+		query = query.Where("id < ?", before)
+	}
+	var changes []model.RatingChange
+	if err := query.Find(&changes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch rating"})
+		return
+	}
+
+	history := make([]RatingChangeResponse, len(changes))
+	for i, ch := range changes {
+		history[i] = RatingChangeResponse{
+			ID:        ch.ID,
+			GameID:    ch.GameID,
+			Opponent:  ch.Opponent,
+			Before:    ch.Before,
+			After:     ch.After,
+			Change:    ch.After - ch.Before,
+			CreatedAt: ch.CreatedAt,
+		}
+	}
+
+	response := gin.H{
+		"user_id":     userID,
+		"rating":      result.Rating,
+		"rated_games": result.RatedGames,
+		"history":     history,
+	}
+	if len(changes) == limit {
+		response["next_before"] = changes[len(changes)-1].ID
+	}
+	c.JSON(http.StatusOK, response)
+}
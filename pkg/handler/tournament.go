@@ -0,0 +1,382 @@
+package handler
+
+import (
+	"halves/pkg/model"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxTournamentPlayers = 32
+
+// StandingResponse is the place of a participant in a tournament
+type StandingResponse struct {
+	UserID string `json:"user_id"`
+	Rank   int    `json:"rank"` // 0 until the tournament finishes
+	Games  int    `json:"games"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	Draws  int    `json:"draws"`
+	Points int    `json:"points"`
+}
+
+type TournamentResponse struct {
+	ID            uint               `json:"id"`
+	Name          string             `json:"name"`
+	CreatedBy     string             `json:"created_by"`
+	Status        string             `json:"status"`
+	CreatedAt     int64              `json:"created_at"`
+	FinishedAt    int64              `json:"finished_at"`
+	Games         int                `json:"games"`
+	FinishedGames int                `json:"finished_games"`
+	Standings     []StandingResponse `json:"standings,omitempty"`
+}
+
+// CreateTournament starts a round robin: every participant, people and bots,
+// gets one open game against every other (moderators only)
+func (h *GameHandler) CreateTournament(c *gin.Context) {
+	var req struct {
+		Name         string   `json:"name" binding:"required,max=100"`
+		Participants []string `json:"participants" binding:"required,dive,uuid"`
+		GameOptions
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	seen := map[string]bool{}
+	participants := []string{}
+	for _, id := range req.Participants {
+		if !seen[id] {
+			seen[id] = true
+			participants = append(participants, id)
+		}
+	}
+	if len(participants) < 2 || len(participants) > maxTournamentPlayers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a tournament needs 2 to 32 participants"})
+		return
+	}
+	var known int64
+	if err := h.db.Model(&model.User{}).Where("id IN ?", participants).Count(&known).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create tournament"})
+		return
+	}
+	if int(known) != len(participants) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown participant"})
+		return
+	}
+	if _, err := req.newGame(participants[0], participants[1]); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	tournament := model.Tournament{
+		Name:      req.Name,
+		CreatedBy: c.MustGet("userID").(string),
+		Status:    model.TournamentRunning,
+		CreatedAt: now.Unix(),
+	}
+	var games []model.Game
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&tournament).Error; err != nil {
+			return err
+		}
+		players := make([]model.TournamentPlayer, len(participants))
+		for i, id := range participants {
+			players[i] = model.TournamentPlayer{TournamentID: tournament.ID, UserID: id}
+		}
+		if err := tx.Create(&players).Error; err != nil {
+			return err
+		}
+
+		// tournament games skip the invite, they start right away
+		for i := range participants {
+			for j := i + 1; j < len(participants); j++ {
+				game, _ := req.newGame(participants[i], participants[j])
+				game.Status = model.GameStatusOpen
+				game.Deadline = now.Add(time.Duration(game.Timeout) * time.Second).Unix()
+				game.TournamentID = tournament.ID
+				games = append(games, game)
+			}
+		}
+		return tx.Create(&games).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create tournament"})
+		return
+	}
+
+	response, err := h.tournamentResponse(&tournament)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tournament"})
+		return
+	}
+	for _, id := range participants {
+		own := []GameDTO{}
+		for i := range games {
+			if games[i].Sender == id || games[i].Receiver == id {
+				own = append(own, newGameDTO(&games[i]))
+			}
+		}
+		h.sendGameNotification(id, gin.H{
+			"type":       "tournament_started",
+			"tournament": response,
+			"games":      own,
+		})
+	}
+	for i := range games {
+		h.scheduleTimeout(games[i].ID, games[i].Deadline)
+		h.playBots(&games[i])
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetTournaments lists the newest 50 tournaments, ?status= filters
+func (h *GameHandler) GetTournaments(c *gin.Context) {
+	query := h.db.Order("id DESC").Limit(50)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var tournaments []model.Tournament
+	if err := query.Find(&tournaments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tournaments"})
+		return
+	}
+
+	response := make([]TournamentResponse, len(tournaments))
+	for i := range tournaments {
+		r, err := h.tournamentResponse(&tournaments[i])
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tournaments"})
+			return
+		}
+		// standings only in the detail
+		r.Standings = nil
+		response[i] = r
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetTournament returns a tournament with its standings
+func (h *GameHandler) GetTournament(c *gin.Context) {
+	var tournament model.Tournament
+	if err := h.db.Where("id = ?", c.Param("id")).First(&tournament).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tournament not found"})
+		return
+	}
+
+	response, err := h.tournamentResponse(&tournament)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tournament"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *GameHandler) tournamentResponse(t *model.Tournament) (TournamentResponse, error) {
+	response := TournamentResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		CreatedBy:  t.CreatedBy,
+		Status:     t.Status,
+		CreatedAt:  t.CreatedAt,
+		FinishedAt: t.FinishedAt,
+	}
+
+	var counts struct {
+		Games    int
+		Finished int
+	}
+	if err := h.db.Model(&model.Game{}).
+		Select("COUNT(*) AS games, COALESCE(SUM(CASE WHEN status IN ? THEN 0 ELSE 1 END), 0) AS finished",
+			[]string{model.GameStatusPending, model.GameStatusOpen}).
+		Where("tournament_id = ?", t.ID).
+		Scan(&counts).Error; err != nil {
+		return response, err
+	}
+	response.Games, response.FinishedGames = counts.Games, counts.Finished
+
+	var players []model.TournamentPlayer
+	if err := h.db.Where("tournament_id = ?", t.ID).
+		Order("points DESC, wins DESC, user_id").
+		Find(&players).Error; err != nil {
+		return response, err
+	}
+	response.Standings = make([]StandingResponse, len(players))
+	for i, p := range players {
+		response.Standings[i] = StandingResponse{
+			UserID: p.UserID,
+			Rank:   p.Rank,
+			Games:  p.Games,
+			Wins:   p.Wins,
+			Losses: p.Losses,
+			Draws:  p.Draws,
+			Points: p.Points,
+		}
+	}
+	return response, nil
+}
+
+// recordTournamentGame adds a closed, played game to the standings of both
+// players. It runs in the transaction that closes the game, so every game
+// counts once.
+func (h *GameHandler) recordTournamentGame(tx *gorm.DB, game *model.Game) error {
+	sides := []struct {
+		player       string
+		mine, theirs int
+	}{
+		{game.Sender, game.Sscore, game.Rscore},
+		{game.Receiver, game.Rscore, game.Sscore},
+	}
+	for _, side := range sides {
+		column := "draws"
+		switch outcomeOf(side.mine, side.theirs) {
+		case outcomeWin:
+			column = "wins"
+		case outcomeLoss:
+			column = "losses"
+		}
+		if err := tx.Model(&model.TournamentPlayer{}).
+			Where("tournament_id = ? AND user_id = ?", game.TournamentID, side.player).
+			Updates(map[string]interface{}{
+				"games":  gorm.Expr("games + 1"),
+				"points": gorm.Expr("points + ?", side.mine),
+				column:   gorm.Expr(column + " + 1"),
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tournamentMatchDone tells the participants about a closed tournament game
+// and finishes the tournament after its last one
+func (h *GameHandler) tournamentMatchDone(game *model.Game) {
+	finished, err := h.finishTournament(game.TournamentID)
+	if err != nil {
+		log.Printf("Failed to finish tournament %d: %v", game.TournamentID, err)
+	}
+
+	var tournament model.Tournament
+	if err := h.db.First(&tournament, game.TournamentID).Error; err != nil {
+		log.Printf("Failed to load tournament %d: %v", game.TournamentID, err)
+		return
+	}
+	response, err := h.tournamentResponse(&tournament)
+	if err != nil {
+		log.Printf("Failed to load tournament %d: %v", game.TournamentID, err)
+		return
+	}
+
+	for _, standing := range response.Standings {
+		h.sendGameNotification(standing.UserID, gin.H{
+			"type":       "tournament_match",
+			"tournament": response,
+			"game":       newGameResponse(game),
+		})
+		if finished {
+			h.sendGameNotification(standing.UserID, gin.H{
+				"type":       "tournament_finished",
+				"tournament": response,
+			})
+		}
+	}
+}
+
+// finishTournament marks the tournament finished once none of its games is
+// left and ranks the participants by points, then wins; equal players share
+// a rank. Only the caller that finishes it gets true.
+func (h *GameHandler) finishTournament(tournamentID uint) (bool, error) {
+	finished := false
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Tournament{}).
+			Where("id = ? AND status = ?", tournamentID, model.TournamentRunning).
+			Where("NOT EXISTS (SELECT 1 FROM games WHERE tournament_id = ? AND status IN ?)",
+				tournamentID, []string{model.GameStatusPending, model.GameStatusOpen}).
+			Updates(map[string]interface{}{"status": model.TournamentFinished, "finished_at": time.Now().Unix()})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		finished = true
+
+		var players []model.TournamentPlayer
+		if err := tx.Where("tournament_id = ?", tournamentID).
+			Order("points DESC, wins DESC, user_id").
+			Find(&players).Error; err != nil {
+			return err
+		}
+		for i := range players {
+			rank := i + 1
+			if prev := i - 1; prev >= 0 && players[prev].Points == players[i].Points && players[prev].Wins == players[i].Wins {
+				rank = players[prev].Rank
+			}
+			players[i].Rank = rank
+			if err := tx.Model(&model.TournamentPlayer{}).
+				Where("tournament_id = ? AND user_id = ?", tournamentID, players[i].UserID).
+				Update("rank", rank).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return finished, nil
+}
+
+// FinishTournaments finishes the tournaments that have no games left, e.g.
+// after the pending games of a deleted participant were cancelled, and tells
+// the remaining participants
+func (h *GameHandler) FinishTournaments(ids []uint) {
+	for _, id := range ids {
+		finished, err := h.finishTournament(id)
+		if err != nil {
+			log.Printf("Failed to finish tournament %d: %v", id, err)
+			continue
+		}
+		if !finished {
+			continue
+		}
+		var tournament model.Tournament
+		if err := h.db.First(&tournament, id).Error; err != nil {
+			log.Printf("Failed to load tournament %d: %v", id, err)
+			continue
+		}
+		response, err := h.tournamentResponse(&tournament)
+		if err != nil {
+			log.Printf("Failed to load tournament %d: %v", id, err)
+			continue
+		}
+		for _, standing := range response.Standings {
+			h.sendGameNotification(standing.UserID, gin.H{
+				"type":       "tournament_finished",
+				"tournament": response,
+			})
+		}
+	}
+}
+
+// ResumeTournaments finishes the tournaments whose last game closed while the
+// server went down before ranking them
+func (h *GameHandler) ResumeTournaments() error {
+	var ids []uint
+	if err := h.db.Model(&model.Tournament{}).Where("status = ?", model.TournamentRunning).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := h.finishTournament(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"halves/pkg/model"
+	"halves/pkg/payoff"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTournament stores a running round robin the way CreateTournament
+// does and returns its games
+func createTournament(t *testing.T, h *GameHandler, participants ...string) (model.Tournament, []model.Game) {
+	tournament := model.Tournament{Name: "cup", CreatedBy: "admin", Status: model.TournamentRunning, CreatedAt: time.Now().Unix()}
+	require.NoError(t, h.db.Create(&tournament).Error)
+	var games []model.Game
+	for i, id := range participants {
+		require.NoError(t, h.db.Create(&model.TournamentPlayer{TournamentID: tournament.ID, UserID: id}).Error)
+		for _, other := range participants[i+1:] {
+			game, err := GameOptions{}.newGame(id, other)
+			require.NoError(t, err)
+			game.Status = model.GameStatusOpen
+			game.Deadline = time.Now().Add(time.Hour).Unix()
+			game.TournamentID = tournament.ID
+			require.NoError(t, h.db.Create(&game).Error)
+			games = append(games, game)
+		}
+	}
+	return tournament, games
+}
+
+func tournamentStandings(t *testing.T, h *GameHandler, id uint) map[string]model.TournamentPlayer {
+	var players []model.TournamentPlayer
+	require.NoError(t, h.db.Where("tournament_id = ?", id).Find(&players).Error)
+	standings := make(map[string]model.TournamentPlayer, len(players))
+	for _, p := range players {
+		standings[p.UserID] = p
+	}
+	return standings
+}
+
+func TestTournamentFinishesWithSharedRanks(t *testing.T) {
+	h := newTestGameHandler(t)
+	tournament, games := createTournament(t, h, "alice", "bob", "carol")
+	require.Len(t, games, 3)
+
+	// alice and bob draw, both beat carol
+	votes := map[[2]string][2]int{
+		{"alice", "bob"}:   {payoff.Cooperate, payoff.Cooperate},
+		{"alice", "carol"}: {payoff.Defect, payoff.Cooperate},
+		{"bob", "carol"}:   {payoff.Defect, payoff.Cooperate},
+	}
+	for i, game := range games {
+		v := votes[[2]string{game.Sender, game.Receiver}]
+		_, err := h.vote(game.Sender, game.ID, v[0])
+		require.NoError(t, err)
+		_, err = h.vote(game.Receiver, game.ID, v[1])
+		require.NoError(t, err)
+
+		require.NoError(t, h.db.First(&tournament, tournament.ID).Error)
+		if i < len(games)-1 {
+			assert.Equal(t, model.TournamentRunning, tournament.Status)
+			for _, p := range tournamentStandings(t, h, tournament.ID) {
+				assert.Zero(t, p.Rank, "ranks are set when the tournament finishes")
+			}
+		}
+	}
+
+	assert.Equal(t, model.TournamentFinished, tournament.Status)
+	assert.NotZero(t, tournament.FinishedAt)
+	standings := tournamentStandings(t, h, tournament.ID)
+	assert.Equal(t, model.TournamentPlayer{TournamentID: tournament.ID, UserID: "alice", Games: 2, Wins: 1, Draws: 1, Points: 8, Rank: 1}, standings["alice"])
+	assert.Equal(t, model.TournamentPlayer{TournamentID: tournament.ID, UserID: "bob", Games: 2, Wins: 1, Draws: 1, Points: 8, Rank: 1}, standings["bob"])
+	// two players share the first place, the next one is third
+	assert.Equal(t, model.TournamentPlayer{TournamentID: tournament.ID, UserID: "carol", Games: 2, Losses: 2, Points: 0, Rank: 3}, standings["carol"])
+
+	// finishing again changes nothing
+	finished, err := h.finishTournament(tournament.ID)
+	require.NoError(t, err)
+	assert.False(t, finished)
+}
+
+func TestTournamentUnplayedGameCountsForNobody(t *testing.T) {
+	h := newTestGameHandler(t)
+	tournament, games := createTournament(t, h, "alice", "bob")
+	require.Len(t, games, 1)
+
+	require.NoError(t, h.db.Model(&games[0]).Update("deadline", time.Now().Add(-time.Second).Unix()).Error)
+	h.expireGame(games[0].ID)
+
+	require.NoError(t, h.db.First(&tournament, tournament.ID).Error)
+	assert.Equal(t, model.TournamentFinished, tournament.Status)
+	for _, p := range tournamentStandings(t, h, tournament.ID) {
+		assert.Zero(t, p.Games)
+		assert.Zero(t, p.Points)
+		assert.Equal(t, 1, p.Rank)
+	}
+}
@@ -21,8 +21,20 @@ var upgrader = websocket.Upgrader{
 }
 
 type Client struct {
-	Conn   *websocket.Conn
-	UserID string
+	Conn     *websocket.Conn
+	UserID   string
+	DeviceID string
+
+	// a connection allows one writer at a time, and handlers, bots and
+	// tournaments all notify from their own goroutines
+	writeMutex sync.Mutex
+}
+
+// WriteJSON sends v to the client; safe for concurrent use
+func (c *Client) WriteJSON(v interface{}) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.Conn.WriteJSON(v)
 }
 
 type Hub struct {
@@ -59,6 +71,29 @@ func (h *Hub) Run() {
 	}
 }
 
+// client returns the live connection of the user
+func (h *Hub) client(userID string) (*Client, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	client, ok := h.clients[userID]
+	return client, ok
+}
+
+// DisconnectUser closes the live connection of the user, if any
+func (h *Hub) DisconnectUser(userID string) {
+	h.unregister <- userID
+}
+
+// DisconnectDevice closes the user's connection only if it was opened from
+// the given device. The handler's read loop then cleans up as usual.
+func (h *Hub) DisconnectDevice(userID, deviceID string) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if client, ok := h.clients[userID]; ok && client.DeviceID == deviceID {
+		client.Conn.Close()
+	}
+}
+
 func (h *Hub) WebSocketHandler(c *gin.Context) {
 	userID := c.Param("uuid")
 	tokenUserID := c.MustGet("userID").(string)
@@ -78,24 +113,18 @@ func (h *Hub) WebSocketHandler(c *gin.Context) {
 	}
 
 	client := &Client{
-		Conn:   conn,
-		UserID: userID,
+		Conn:     conn,
+		UserID:   userID,
+		DeviceID: deviceID,
 	}
-	// Update device status
-	// db.Model(&model.Device{}).Where("id = ?", deviceID).Updates(map[string]interface{}{
-	// 	"last_seen": time.Now().Unix(),
-	// 	"status":    "online",
-	// })
-	db.Model(&model.Device{}).
-		Where("id = ?", deviceID).
-		Updates(map[string]interface{}{
-			"status":    "O",
-			"last_seen": time.Now().Unix(),
-		})
-	// Create or update device
+	// mark the device online; a device id taken by another user is left alone
 	db.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "id"}},
-		DoUpdates: clause.Assignments(map[string]interface{}{"status": "O"}),
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"status":    "O",
+			"last_seen": now,
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "devices.user_id = excluded.user_id"}}},
 	}).Create(&model.Device{
 		ID:        deviceID,
 		UserID:    userID,
@@ -104,12 +133,11 @@ func (h *Hub) WebSocketHandler(c *gin.Context) {
 		UserAgent: c.GetHeader("User-Agent"),
 	})
 
-	//end of Update device status
 	h.register <- client
 	defer func() {
 		// Update device status
 		db.Model(&model.Device{}).
-			Where("id = ?", deviceID).
+			Where("id = ? AND user_id = ?", deviceID, userID).
 			Update("status", "F")
 		h.unregister <- userID
 		conn.Close()
@@ -0,0 +1,44 @@
+// Package leaderboard defines the calendar windows leaderboards are computed
+// over. Windows are in UTC and reset at their boundaries.
+package leaderboard
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Periods of a leaderboard
+const (
+	AllTime = "all"
+	Daily   = "daily"
+	Weekly  = "weekly" // weeks start on Monday
+	Monthly = "monthly"
+)
+
+var ErrUnknownPeriod = errors.New("period must be all, daily, weekly or monthly")
+
+// Window returns the Unix timestamps [from, to) of the period that contains
+// at; AllTime covers every timestamp
+func Window(period string, at time.Time) (int64, int64, error) {
+	at = at.UTC()
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+
+	var from, to time.Time
+	switch period {
+	case AllTime:
+		return 0, math.MaxInt64, nil
+	case Daily:
+		from, to = day, day.AddDate(0, 0, 1)
+	case Weekly:
+		// Sunday is 0, the end of the week
+		from = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		to = from.AddDate(0, 0, 7)
+	case Monthly:
+		from = time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+		to = from.AddDate(0, 1, 0)
+	default:
+		return 0, 0, ErrUnknownPeriod
+	}
+	return from.Unix(), to.Unix(), nil
+}
@@ -0,0 +1,43 @@
+package leaderboard
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindow(t *testing.T) {
+	date := func(y int, m time.Month, d, h int) int64 {
+		return time.Date(y, m, d, h, 0, 0, 0, time.UTC).Unix()
+	}
+	// a Sunday evening in UTC, already Monday east of it
+	at := time.Date(2025, time.December, 28, 23, 30, 0, 0, time.FixedZone("X", -3600))
+
+	cases := []struct {
+		period   string
+		from, to int64
+	}{
+		{Daily, date(2025, time.December, 29, 0), date(2025, time.December, 30, 0)},
+		{Weekly, date(2025, time.December, 29, 0), date(2026, time.January, 5, 0)},
+		{Monthly, date(2025, time.December, 1, 0), date(2026, time.January, 1, 0)},
+		{AllTime, 0, math.MaxInt64},
+	}
+	for _, tc := range cases {
+		from, to, err := Window(tc.period, at)
+		require.NoError(t, err, tc.period)
+		assert.Equal(t, tc.from, from, tc.period)
+		assert.Equal(t, tc.to, to, tc.period)
+	}
+
+	// Sunday belongs to the week that started on Monday before it
+	from, to, err := Window(Weekly, time.Date(2025, time.December, 28, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, date(2025, time.December, 22, 0), from)
+	assert.Equal(t, date(2025, time.December, 29, 0), to)
+
+	_, _, err = Window("yearly", at)
+	assert.ErrorIs(t, err, ErrUnknownPeriod)
+}
@@ -3,6 +3,7 @@ package mail
 import (
 	"bytes"
 	"fmt"
+	"net/mail"
 	"net/smtp"
 	"os"
 	"strings"
@@ -35,17 +36,27 @@ func Send(cfg Config, et EmailTemplate) error {
 		Parse(string(tplContent)))
 
 	// Add required From header to variables
+	if et.Variables == nil {
+		et.Variables = make(map[string]string)
+	}
 	et.Variables["FROM_HEADER"] = cfg.FromHeader
+	et.Variables["TO"] = et.To
 
 	// Execute template with variables
 	var buf bytes.Buffer
 	if err := tpl.Execute(&buf, et.Variables); err != nil {
 		return fmt.Errorf("template execution failed: %w", err)
 	}
-	// Connect to SMTP server
-	auth := smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPass, strings.Split(cfg.SMTPAddr, ":")[0])
+	// Connect to SMTP server, authenticating only when credentials are set
+	var auth smtp.Auth
+	if cfg.SMTPUser != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPass, strings.Split(cfg.SMTPAddr, ":")[0])
+	}
 	msg := buf.Bytes()
 	from := "noreply@example.com"
+	if addr, err := mail.ParseAddress(cfg.FromHeader); err == nil {
+		from = addr.Address
+	}
 	return smtp.SendMail(
 		cfg.SMTPAddr,
 		auth,
@@ -0,0 +1,98 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sender interface defines the email delivery contract
+type Sender interface {
+	Send(et EmailTemplate) error
+}
+
+// SMTPSender renders the template and delivers it over SMTP
+type SMTPSender struct {
+	Config Config
+}
+
+// Send renders and sends the email through Send
+func (s *SMTPSender) Send(et EmailTemplate) error {
+	return Send(s.Config, et)
+}
+
+// WebhookSender hands the email to an external service (EMAIL_WEBHOOK) which
+// renders and delivers it itself
+type WebhookSender struct {
+	URL    string
+	client *http.Client
+}
+
+// NewWebhookSender creates a webhook sender with a bounded request timeout
+func NewWebhookSender(url string) *WebhookSender {
+	return &WebhookSender{URL: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Send posts the template name and variables to the webhook
+func (w *WebhookSender) Send(et EmailTemplate) error {
+	payload := map[string]interface{}{
+		"email":     et.To,
+		"template":  strings.TrimSuffix(filepath.Base(et.TemplatePath), filepath.Ext(et.TemplatePath)),
+		"variables": et.Variables,
+	}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	resp, err := w.client.Post(w.URL, "application/json", bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return fmt.Errorf("failed to call email webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("email webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ConfigFromEnv reads the SMTP settings from the environment
+func ConfigFromEnv() Config {
+	cfg := Config{
+		SMTPAddr:   os.Getenv("SMTP_ADDR"),
+		SMTPUser:   os.Getenv("SMTP_USER"),
+		SMTPPass:   os.Getenv("SMTP_PASS"),
+		FromHeader: os.Getenv("MAIL_FROM"),
+	}
+	if cfg.SMTPAddr == "" {
+		cfg.SMTPAddr = "localhost:25"
+	}
+	if cfg.FromHeader == "" {
+		cfg.FromHeader = "Halves <noreply@example.com>"
+	}
+	return cfg
+}
+
+// NewSenderFromEnv picks the transport from MAIL_TRANSPORT: "smtp" (default)
+// or "webhook", which posts to EMAIL_WEBHOOK
+func NewSenderFromEnv() Sender {
+	if strings.EqualFold(os.Getenv("MAIL_TRANSPORT"), "webhook") {
+		return NewWebhookSender(os.Getenv("EMAIL_WEBHOOK"))
+	}
+	return &SMTPSender{Config: ConfigFromEnv()}
+}
+
+// TemplatePath resolves a template name against MAIL_TEMPLATES_DIR
+func TemplatePath(name string) string {
+	dir := os.Getenv("MAIL_TEMPLATES_DIR")
+	if dir == "" {
+		dir = "templates"
+	}
+	return filepath.Join(dir, name+".eml")
+}
@@ -0,0 +1,42 @@
+package mail
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSender(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sender := NewWebhookSender(srv.URL)
+	err := sender.Send(EmailTemplate{
+		TemplatePath: TemplatePath("reset"),
+		To:           "user@example.com",
+		Variables:    map[string]string{"TOKEN": "abc"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "user@example.com", got["email"])
+	assert.Equal(t, "reset", got["template"])
+	assert.Equal(t, map[string]interface{}{"TOKEN": "abc"}, got["variables"])
+
+	t.Run("error status", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer failing.Close()
+
+		err := NewWebhookSender(failing.URL).Send(EmailTemplate{TemplatePath: TemplatePath("reset"), To: "user@example.com"})
+		assert.Error(t, err)
+	})
+}
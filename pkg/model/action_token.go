@@ -0,0 +1,18 @@
+package model
+
+// ActionToken is a single-use token sent to the user by email, such as a
+// password reset link. Only the sha256 of the token is stored.
+type ActionToken struct {
+	ID        string `gorm:"primaryKey;size:36"`
+	UserID    string `gorm:"index;not null;size:36"`
+	Purpose   string `gorm:"index;not null;size:32"` // pwd_reset, ...
+	TokenHash string `gorm:"uniqueIndex;not null;size:64"`
+	Data      string `gorm:"size:255"` // purpose specific payload
+	CreatedAt int64  `gorm:"not null"` // Unix timestamp
+	ExpiresAt int64  `gorm:"index;not null"`
+	UsedAt    int64  `gorm:"default:0;not null"`
+}
+
+func (ActionToken) TableName() string {
+	return "action_tokens"
+}
@@ -0,0 +1,20 @@
+package model
+
+// APIKey is a long-lived credential for bots and scripts. The key is shown
+// once on creation; only its prefix and sha256 are stored.
+type APIKey struct {
+	ID         string `gorm:"primaryKey;size:36"`
+	UserID     string `gorm:"index;not null;size:36"`
+	Name       string `gorm:"not null;size:100"`
+	Prefix     string `gorm:"uniqueIndex;not null;size:16"` // hlv_xxxxxxxx, identifies the key in logs and lists
+	KeyHash    string `gorm:"not null;size:64"`
+	Scopes     string `gorm:"not null;size:255"` // space separated
+	CreatedAt  int64  `gorm:"not null"`          // Unix timestamp
+	LastUsedAt int64  `gorm:"default:0;not null"`
+	ExpiresAt  int64  `gorm:"default:0;not null"` // 0 - never
+	RevokedAt  int64  `gorm:"default:0;not null"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
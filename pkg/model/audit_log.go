@@ -0,0 +1,17 @@
+package model
+
+// AuditLog records security relevant events such as failed logins and
+// lockouts
+type AuditLog struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    string `gorm:"index;size:36"` // empty if the account is unknown
+	Event     string `gorm:"index;not null;size:32"`
+	IP        string `gorm:"size:45"`
+	UserAgent string `gorm:"size:500"`
+	Detail    string `gorm:"size:255"`
+	CreatedAt int64  `gorm:"index;not null"` // Unix timestamp
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -2,6 +2,17 @@ package model
 
 import "time"
 
+// Game statuses: an invite is pending until the receiver answers it, an
+// accepted game is open until its last round
+const (
+	GameStatusPending   = "pending"
+	GameStatusOpen      = "open"
+	GameStatusClosed    = "closed"
+	GameStatusDeclined  = "declined"
+	GameStatusCancelled = "cancelled"
+	GameStatusExpired   = "expired"
+)
+
 // Model
 type Game struct {
 	ID       uint      `gorm:"primaryKey"`
@@ -10,7 +21,24 @@ type Game struct {
 	Created  time.Time `gorm:"index;not null"`
 	Svote    int       `gorm:"default:0"`
 	Rvote    int       `gorm:"default:0"`
-	Status   string    `gorm:"default:'open';check:status IN ('open', 'closed')"`
+	Status   string    `gorm:"default:'pending';check:chk_games_state,status IN ('pending', 'open', 'closed', 'declined', 'cancelled', 'expired')"`
+	Timeout  int64     `gorm:"default:7200;not null"`    // seconds the players have to vote
+	Deadline int64     `gorm:"index;default:0;not null"` // Unix timestamp, the invite expires or the round times out after it
+	ClosedAt int64     `gorm:"index;default:0;not null"` // Unix timestamp, 0 while the game runs
+	Type     string    `gorm:"size:32;default:'prisoners_dilemma';not null"`
+	// iterated games: the game ends after Rounds rounds or, with
+	// StopProbability set, randomly after each round
+	Rounds          int     `gorm:"default:1;not null"`
+	StopProbability float64 `gorm:"default:0;not null"`
+	Round           int     `gorm:"default:1;not null"` // current round, Svote and Rvote belong to it
+	Sscore          int     `gorm:"default:0;not null"` // points of the finished rounds
+	Rscore          int     `gorm:"default:0;not null"`
+	TournamentID    uint    `gorm:"index;default:0;not null"` // 0 - not part of a tournament
+	// payoff of custom games, the other types use their preset matrix
+	Reward     int `gorm:"default:0;not null"`
+	Sucker     int `gorm:"default:0;not null"`
+	Temptation int `gorm:"default:0;not null"`
+	Punishment int `gorm:"default:0;not null"`
 }
 
 func (Game) TableName() string {
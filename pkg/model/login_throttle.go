@@ -0,0 +1,15 @@
+package model
+
+// LoginThrottle counts recent failed logins for one account or client IP
+type LoginThrottle struct {
+	Scope        string `gorm:"primaryKey;size:16"`  // account or ip
+	Key          string `gorm:"primaryKey;size:255"` // lowercased email or client IP
+	Failures     int    `gorm:"not null;default:0"`
+	LastFailure  int64  `gorm:"index;not null"`     // Unix timestamp
+	BlockedUntil int64  `gorm:"not null;default:0"` // no attempts before this
+	LockedUntil  int64  `gorm:"not null;default:0"` // set while locked out
+}
+
+func (LoginThrottle) TableName() string {
+	return "login_throttles"
+}
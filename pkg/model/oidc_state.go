@@ -0,0 +1,19 @@
+package model
+
+// OIDCState remembers an OpenID Connect authorization request between the
+// redirect to the provider and the callback. Only the sha256 of the state is
+// stored.
+type OIDCState struct {
+	StateHash    string `gorm:"primaryKey;size:64"`
+	Provider     string `gorm:"not null;size:32"`
+	Nonce        string `gorm:"not null;size:64"`
+	CodeVerifier string `gorm:"not null;size:128"` // PKCE
+	DeviceID     string `gorm:"size:64"`           // tokens are bound to the device that started the flow
+	CreatedAt    int64  `gorm:"not null"`          // Unix timestamp
+	ExpiresAt    int64  `gorm:"index;not null"`
+	UsedAt       int64  `gorm:"default:0;not null"`
+}
+
+func (OIDCState) TableName() string {
+	return "oidc_states"
+}
@@ -0,0 +1,16 @@
+package model
+
+// RatingChange is the change of a user's rating by one game
+type RatingChange struct {
+	ID        uint    `gorm:"primaryKey"`
+	UserID    string  `gorm:"uniqueIndex:idx_rating_user_game;index:idx_rating_user_created;not null"`
+	GameID    uint    `gorm:"uniqueIndex:idx_rating_user_game;not null"`
+	Opponent  string  `gorm:"not null"`
+	Before    float64 `gorm:"not null"`
+	After     float64 `gorm:"not null"`
+	CreatedAt int64   `gorm:"index:idx_rating_user_created;not null"`
+}
+
+func (RatingChange) TableName() string {
+	return "rating_changes"
+}
@@ -0,0 +1,14 @@
+package model
+
+// RecoveryCode is a one-time 2FA fallback code, stored as a sha256 hash
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    string `gorm:"index;not null;size:36"`
+	CodeHash  string `gorm:"uniqueIndex;not null;size:64"`
+	CreatedAt int64  `gorm:"not null"`
+	UsedAt    int64  `gorm:"default:0;not null"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
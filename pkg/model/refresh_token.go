@@ -0,0 +1,23 @@
+package model
+
+// RefreshToken is a single link in a rotation chain. Every refresh issues a new
+// row in the same family and marks the previous one as used; presenting a used
+// token again means it leaked, so the whole family is revoked.
+type RefreshToken struct {
+	ID        string `gorm:"primaryKey;size:36"`
+	UserID    string `gorm:"index;not null;size:36"`
+	DeviceID  string `gorm:"index;size:64"`
+	FamilyID  string `gorm:"index;not null;size:36"`
+	TokenHash string `gorm:"uniqueIndex;not null;size:64"` // hex sha256 of the opaque token
+	CreatedAt int64  `gorm:"not null"`                     // Unix timestamp
+	ExpiresAt int64  `gorm:"index;not null"`
+	UsedAt    int64  `gorm:"default:0;not null"` // set once the token was rotated
+	RevokedAt int64  `gorm:"default:0;not null"`
+	// Access token issued together with this refresh token
+	AccessJTI       string `gorm:"index;size:36"`
+	AccessExpiresAt int64  `gorm:"default:0;not null"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
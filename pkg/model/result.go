@@ -6,6 +6,8 @@ type Result struct {
 	UserID      string    `gorm:"primaryKey"`
 	Score       int       `gorm:"default:0;not null"`
 	LastUpdated time.Time `gorm:"index;autoUpdateTime"`
+	Rating      float64   `gorm:"index;default:1500;not null"` // Elo, see pkg/rating
+	RatedGames  int       `gorm:"default:0;not null"`
 	game        uint      `gorm:"default:0"`
 }
 
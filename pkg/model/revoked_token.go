@@ -0,0 +1,14 @@
+package model
+
+// RevokedToken blacklists an access token by its jti until it would have
+// expired anyway
+type RevokedToken struct {
+	JTI       string `gorm:"primaryKey;size:36"`
+	UserID    string `gorm:"index;not null;size:36"`
+	ExpiresAt int64  `gorm:"index;not null"` // Unix timestamp
+	RevokedAt int64  `gorm:"not null"`
+}
+
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
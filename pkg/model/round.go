@@ -0,0 +1,18 @@
+package model
+
+// Round is a finished round of a game with the votes and points of both players
+type Round struct {
+	ID        uint  `gorm:"primaryKey"`
+	GameID    uint  `gorm:"uniqueIndex:idx_round_game_number;not null"`
+	Number    int   `gorm:"uniqueIndex:idx_round_game_number;not null"`
+	Svote     int   `gorm:"not null"`
+	Rvote     int   `gorm:"not null"`
+	Sscore    int   `gorm:"not null"`
+	Rscore    int   `gorm:"not null"`
+	TimedOut  bool  `gorm:"default:false;not null"`
+	CreatedAt int64 `gorm:"not null"`
+}
+
+func (Round) TableName() string {
+	return "rounds"
+}
@@ -0,0 +1,40 @@
+package model
+
+// Season statuses
+const (
+	SeasonRunning  = "running"
+	SeasonFinished = "finished"
+)
+
+// Season is a named leaderboard over the games closed between StartsAt and
+// EndsAt; seasons don't overlap
+type Season struct {
+	ID         uint   `gorm:"primaryKey"`
+	Name       string `gorm:"size:100;uniqueIndex;not null"`
+	StartsAt   int64  `gorm:"index;not null"`
+	EndsAt     int64  `gorm:"index;not null"`
+	Status     string `gorm:"size:16;index;default:'running';not null"`
+	CreatedBy  string `gorm:"size:36;not null"`
+	CreatedAt  int64  `gorm:"not null"`
+	FinishedAt int64  `gorm:"default:0;not null"`
+}
+
+func (Season) TableName() string {
+	return "seasons"
+}
+
+// SeasonStanding is the archived final place of a player in a season
+type SeasonStanding struct {
+	SeasonID uint   `gorm:"primaryKey"`
+	UserID   string `gorm:"primaryKey;size:36;index"`
+	Rank     int    `gorm:"not null"`
+	Games    int    `gorm:"not null"`
+	Wins     int    `gorm:"not null"`
+	Losses   int    `gorm:"not null"`
+	Draws    int    `gorm:"not null"`
+	Points   int    `gorm:"not null"`
+}
+
+func (SeasonStanding) TableName() string {
+	return "season_standings"
+}
@@ -0,0 +1,39 @@
+package model
+
+// Tournament statuses
+const (
+	TournamentRunning  = "running"
+	TournamentFinished = "finished"
+)
+
+// Tournament is a round robin: every participant plays one game against
+// every other, the games carry the TournamentID
+type Tournament struct {
+	ID         uint   `gorm:"primaryKey"`
+	Name       string `gorm:"size:100;not null"`
+	CreatedBy  string `gorm:"size:36;not null"`
+	Status     string `gorm:"size:16;index;default:'running';not null"`
+	CreatedAt  int64  `gorm:"not null"`
+	FinishedAt int64  `gorm:"default:0;not null"`
+}
+
+func (Tournament) TableName() string {
+	return "tournaments"
+}
+
+// TournamentPlayer is the standing of a participant, updated as each of
+// their games closes
+type TournamentPlayer struct {
+	TournamentID uint   `gorm:"primaryKey"`
+	UserID       string `gorm:"primaryKey;size:36;index"`
+	Games        int    `gorm:"default:0;not null"` // finished games
+	Wins         int    `gorm:"default:0;not null"`
+	Losses       int    `gorm:"default:0;not null"`
+	Draws        int    `gorm:"default:0;not null"`
+	Points       int    `gorm:"default:0;not null"`
+	Rank         int    `gorm:"default:0;not null"` // set when the tournament finishes
+}
+
+func (TournamentPlayer) TableName() string {
+	return "tournament_players"
+}
@@ -8,4 +8,38 @@ type User struct {
 	CreatedAt int64  `gorm:"not null"` // time.Time
 	LastSeen  int64  `gorm:"not null"`
 	Score     int    `gorm:"default:0"`
+	// Set once the user followed the link from the verification email
+	EmailVerified bool `gorm:"default:false;not null"`
+	// TOTP two-factor authentication; the secret is kept while enrolling
+	// and only enforced once TOTPEnabled is set
+	TOTPSecret   string `gorm:"size:64"`
+	TOTPEnabled  bool   `gorm:"default:false;not null"`
+	TOTPLastStep int64  `gorm:"default:0;not null"` // last accepted time step, blocks code replay
+	// Access level: user, moderator or admin
+	Role string `gorm:"size:16;default:'user';not null"`
+	// Set when the user asked to delete the account; all data is purged
+	// after this Unix timestamp unless the request is cancelled
+	DeleteAfter int64 `gorm:"index;default:0;not null"`
+	// Strategy a server-side bot plays, empty for people
+	Strategy string `gorm:"size:32;default:'';not null"`
+}
+
+// Roles, each one includes the permissions of the ones before it
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// RoleRank orders roles by privilege; unknown roles rank below user
+func RoleRank(role string) int {
+	switch role {
+	case RoleUser:
+		return 1
+	case RoleModerator:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
 }
@@ -0,0 +1,16 @@
+package model
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider, identified by the provider's stable subject
+type UserIdentity struct {
+	ID        string `gorm:"primaryKey;size:36"`
+	UserID    string `gorm:"index;not null;size:36"`
+	Provider  string `gorm:"uniqueIndex:idx_identity_subject;not null;size:32"`
+	Subject   string `gorm:"uniqueIndex:idx_identity_subject;not null;size:255"`
+	Email     string `gorm:"size:255"` // as reported by the provider at link time
+	CreatedAt int64  `gorm:"not null"` // Unix timestamp
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
@@ -0,0 +1,143 @@
+// Package payoff defines the symmetric 2x2 games players can invite each
+// other to and the points each outcome is worth.
+package payoff
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Votes of a game: an upvote cooperates, a downvote defects
+const (
+	Cooperate = 1
+	Defect    = -1
+)
+
+// MaxPoints bounds every cell of a custom matrix
+const MaxPoints = 100
+
+const (
+	PrisonersDilemma = "prisoners_dilemma"
+	StagHunt         = "stag_hunt"
+	Chicken          = "chicken"
+	Custom           = "custom"
+)
+
+// Matrix holds the points of a player for each outcome. Games are symmetric,
+// the opponent's points are read from the same matrix with the moves swapped.
+type Matrix struct {
+	Reward     int `json:"reward"`     // both cooperate
+	Sucker     int `json:"sucker"`     // cooperated, the opponent defected
+	Temptation int `json:"temptation"` // defected, the opponent cooperated
+	Punishment int `json:"punishment"` // both defect
+}
+
+// Points returns the points of a player who voted own against other
+func (m Matrix) Points(own, other int) int {
+	switch {
+	case own == Cooperate && other == Cooperate:
+		return m.Reward
+	case own == Cooperate && other == Defect:
+		return m.Sucker
+	case own == Defect && other == Cooperate:
+		return m.Temptation
+	default:
+		return m.Punishment
+	}
+}
+
+// Scores returns the points of both players, ok is false unless both voted
+func (m Matrix) Scores(a, b int) (int, int, bool) {
+	if !valid(a) || !valid(b) {
+		return 0, 0, false
+	}
+	return m.Points(a, b), m.Points(b, a), true
+}
+
+// Validate checks that every cell is within 0..MaxPoints
+func (m Matrix) Validate() error {
+	for _, v := range []int{m.Reward, m.Sucker, m.Temptation, m.Punishment} {
+		if v < 0 || v > MaxPoints {
+			return fmt.Errorf("payoff values must be between 0 and %d", MaxPoints)
+		}
+	}
+	return nil
+}
+
+func valid(vote int) bool {
+	return vote == Cooperate || vote == Defect
+}
+
+// Type is a game players can choose when inviting
+type Type struct {
+	Name        string  `json:"name"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Payoff      *Matrix `json:"payoff,omitempty"` // nil for custom
+}
+
+var types = []Type{
+	{
+		Name:        PrisonersDilemma,
+		Title:       "Prisoner's dilemma",
+		Description: "Defecting always pays more, yet both players do better when they cooperate.",
+		Payoff:      &Matrix{Reward: 3, Sucker: 0, Temptation: 5, Punishment: 1},
+	},
+	{
+		Name:        StagHunt,
+		Title:       "Stag hunt",
+		Description: "Cooperating pays most, but only if the opponent cooperates too.",
+		Payoff:      &Matrix{Reward: 4, Sucker: 0, Temptation: 3, Punishment: 2},
+	},
+	{
+		Name:        Chicken,
+		Title:       "Chicken",
+		Description: "Defecting wins against a cooperator, but both defecting is the worst outcome.",
+		Payoff:      &Matrix{Reward: 3, Sucker: 1, Temptation: 5, Punishment: 0},
+	},
+	{
+		Name:        Custom,
+		Title:       "Custom",
+		Description: "The sender sets the payoff matrix.",
+	},
+}
+
+// ErrUnknownType is returned by Resolve for names that aren't in Types
+var ErrUnknownType = errors.New("unknown game type")
+
+// Types returns the available game types
+func Types() []Type {
+	out := make([]Type, len(types))
+	for i, t := range types {
+		if t.Payoff != nil {
+			m := *t.Payoff
+			t.Payoff = &m
+		}
+		out[i] = t
+	}
+	return out
+}
+
+// Resolve returns the matrix of the named type; custom is required for the
+// custom type and rejected for the others. An empty name is the prisoner's
+// dilemma.
+func Resolve(name string, custom *Matrix) (Matrix, error) {
+	if name == "" {
+		name = PrisonersDilemma
+	}
+	if name == Custom {
+		if custom == nil {
+			return Matrix{}, errors.New("custom games need a payoff")
+		}
+		return *custom, custom.Validate()
+	}
+	for _, t := range types {
+		if t.Name == name {
+			if custom != nil {
+				return Matrix{}, errors.New("payoff can only be set for custom games")
+			}
+			return *t.Payoff, nil
+		}
+	}
+	return Matrix{}, ErrUnknownType
+}
@@ -0,0 +1,66 @@
+package payoff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrisonersDilemmaScores(t *testing.T) {
+	m, err := Resolve(PrisonersDilemma, nil)
+	require.NoError(t, err)
+
+	cases := []struct {
+		a, b       int
+		aPts, bPts int
+	}{
+		{Cooperate, Defect, 0, 5},
+		{Defect, Cooperate, 5, 0},
+		{Cooperate, Cooperate, 3, 3},
+		{Defect, Defect, 1, 1},
+	}
+	for _, tc := range cases {
+		a, b, ok := m.Scores(tc.a, tc.b)
+		assert.True(t, ok)
+		assert.Equal(t, tc.aPts, a, "votes %d/%d", tc.a, tc.b)
+		assert.Equal(t, tc.bPts, b, "votes %d/%d", tc.a, tc.b)
+	}
+
+	_, _, ok := m.Scores(Cooperate, 0)
+	assert.False(t, ok, "missing vote")
+}
+
+func TestResolve(t *testing.T) {
+	m, err := Resolve("", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5, m.Temptation, "defaults to prisoner's dilemma")
+
+	m, err = Resolve(StagHunt, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 4, m.Points(Cooperate, Cooperate))
+
+	_, err = Resolve("poker", nil)
+	assert.ErrorIs(t, err, ErrUnknownType)
+
+	_, err = Resolve(Chicken, &Matrix{})
+	assert.Error(t, err, "payoff is only for custom games")
+
+	_, err = Resolve(Custom, nil)
+	assert.Error(t, err)
+
+	_, err = Resolve(Custom, &Matrix{Reward: MaxPoints + 1})
+	assert.Error(t, err)
+
+	m, err = Resolve(Custom, &Matrix{Reward: 2, Sucker: 7, Temptation: 0, Punishment: 1})
+	require.NoError(t, err)
+	a, b, _ := m.Scores(Cooperate, Defect)
+	assert.Equal(t, 7, a)
+	assert.Equal(t, 0, b)
+}
+
+func TestTypesIsACopy(t *testing.T) {
+	ts := Types()
+	ts[0].Name = "changed"
+	assert.Equal(t, PrisonersDilemma, Types()[0].Name)
+}
@@ -0,0 +1,57 @@
+// Package rating implements the Elo rating of players: the winner of a game
+// takes points from the loser, more of them the less the win was expected.
+package rating
+
+import "math"
+
+const (
+	// Initial is the rating of a player without rated games
+	Initial = 1500.0
+	// Provisional is the number of games a new player's rating moves faster
+	Provisional = 30
+
+	provisionalK = 40.0
+	establishedK = 20.0
+)
+
+// Results of a game for the first player
+const (
+	Loss = 0.0
+	Draw = 0.5
+	Win  = 1.0
+)
+
+// Expected returns the score a player rated a is expected to get against one
+// rated b, between 0 and 1
+func Expected(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// K is the largest change a single game can make to a rating of a player
+// with the given number of rated games
+func K(games int) float64 {
+	if games < Provisional {
+		return provisionalK
+	}
+	return establishedK
+}
+
+// Update returns the new ratings of two players after a game with the result
+// score (Win, Draw or Loss) for a; games are the numbers of rated games each
+// of them played before it
+func Update(a, b float64, aGames, bGames int, score float64) (float64, float64) {
+	expected := Expected(a, b)
+	return a + K(aGames)*(score-expected), b + K(bGames)*(expected-score)
+}
+
+// Result returns Win, Draw or Loss for the first of two final game scores
+func Result(mine, theirs int) float64 {
+	switch {
+	case mine > theirs:
+		return Win
+	case mine < theirs:
+		return Loss
+	default:
+		return Draw
+	}
+}
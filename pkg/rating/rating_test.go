@@ -0,0 +1,40 @@
+package rating
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpected(t *testing.T) {
+	assert.InDelta(t, 0.5, Expected(1500, 1500), 1e-9)
+	assert.InDelta(t, 0.909, Expected(1800, 1400), 1e-3)
+	assert.InDelta(t, 1, Expected(1500, 1700)+Expected(1700, 1500), 1e-9)
+}
+
+func TestUpdate(t *testing.T) {
+	// equal new players: the winner gets half of K
+	a, b := Update(Initial, Initial, 0, 0, Win)
+	assert.InDelta(t, 1520, a, 1e-9)
+	assert.InDelta(t, 1480, b, 1e-9)
+
+	a, b = Update(Initial, Initial, 0, 0, Draw)
+	assert.InDelta(t, Initial, a, 1e-9)
+	assert.InDelta(t, Initial, b, 1e-9)
+
+	// an upset moves more than an expected win
+	upA, _ := Update(1400, 1800, Provisional, Provisional, Win)
+	favA, _ := Update(1800, 1400, Provisional, Provisional, Win)
+	assert.Greater(t, upA-1400, favA-1800)
+
+	// established ratings move slower
+	a, b = Update(Initial, Initial, Provisional, 0, Loss)
+	assert.InDelta(t, 1490, a, 1e-9)
+	assert.InDelta(t, 1520, b, 1e-9)
+}
+
+func TestResult(t *testing.T) {
+	assert.Equal(t, Win, Result(5, 0))
+	assert.Equal(t, Loss, Result(0, 5))
+	assert.Equal(t, Draw, Result(3, 3))
+}
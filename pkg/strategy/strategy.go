@@ -0,0 +1,117 @@
+// Package strategy implements the classic strategies the server-side bots
+// play iterated games with.
+package strategy
+
+import (
+	"math/rand/v2"
+	"sort"
+
+	"halves/pkg/payoff"
+)
+
+// Round is a finished round seen by the player: its own vote and the
+// opponent's, payoff.Cooperate or payoff.Defect
+type Round struct {
+	Own      int
+	Opponent int
+}
+
+// Strategy picks the next vote from the finished rounds of the game, oldest
+// first
+type Strategy interface {
+	Name() string
+	Description() string
+	Move(history []Round) int
+}
+
+// TitForTat cooperates first, then repeats the opponent's last vote
+type TitForTat struct{}
+
+func (TitForTat) Name() string { return "tit_for_tat" }
+func (TitForTat) Description() string {
+	return "Cooperates first, then copies the opponent's last move."
+}
+func (TitForTat) Move(history []Round) int {
+	if len(history) == 0 {
+		return payoff.Cooperate
+	}
+	return history[len(history)-1].Opponent
+}
+
+// AlwaysDefect never cooperates
+type AlwaysDefect struct{}
+
+func (AlwaysDefect) Name() string        { return "always_defect" }
+func (AlwaysDefect) Description() string { return "Always defects." }
+func (AlwaysDefect) Move([]Round) int    { return payoff.Defect }
+
+// Grudger cooperates until the opponent defects once, then defects forever
+type Grudger struct{}
+
+func (Grudger) Name() string { return "grudger" }
+func (Grudger) Description() string {
+	return "Cooperates until the opponent defects once, then never forgives."
+}
+func (Grudger) Move(history []Round) int {
+	for _, r := range history {
+		if r.Opponent == payoff.Defect {
+			return payoff.Defect
+		}
+	}
+	return payoff.Cooperate
+}
+
+// Random cooperates and defects with equal chance
+type Random struct{}
+
+func (Random) Name() string        { return "random" }
+func (Random) Description() string { return "Cooperates or defects at random." }
+func (Random) Move([]Round) int {
+	if rand.IntN(2) == 0 {
+		return payoff.Defect
+	}
+	return payoff.Cooperate
+}
+
+// Pavlov (win-stay, lose-shift) cooperates first, then cooperates when both
+// players made the same move in the last round and defects otherwise
+type Pavlov struct{}
+
+func (Pavlov) Name() string { return "pavlov" }
+func (Pavlov) Description() string {
+	return "Win-stay, lose-shift: keeps its move after a good round, switches after a bad one."
+}
+func (Pavlov) Move(history []Round) int {
+	if len(history) == 0 {
+		return payoff.Cooperate
+	}
+	last := history[len(history)-1]
+	if last.Own == last.Opponent {
+		return payoff.Cooperate
+	}
+	return payoff.Defect
+}
+
+var strategies = map[string]Strategy{}
+
+func init() {
+	for _, s := range []Strategy{TitForTat{}, AlwaysDefect{}, Grudger{}, Random{}, Pavlov{}} {
+		strategies[s.Name()] = s
+	}
+}
+
+// Get returns the strategy with the given name
+func Get(name string) (Strategy, bool) {
+	s, ok := strategies[name]
+	return s, ok
+}
+
+// All returns every strategy, sorted by name
+func All() []Strategy {
+	out := make([]Strategy, 0, len(strategies))
+	for _, s := range strategies {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out
+}
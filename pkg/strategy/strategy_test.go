@@ -0,0 +1,65 @@
+package strategy
+
+import (
+	"testing"
+
+	"halves/pkg/payoff"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	c = payoff.Cooperate
+	d = payoff.Defect
+)
+
+// play returns the moves of s against the fixed opponent moves
+func play(s Strategy, opponent ...int) []int {
+	var history []Round
+	moves := make([]int, 0, len(opponent)+1)
+	for _, o := range opponent {
+		own := s.Move(history)
+		moves = append(moves, own)
+		history = append(history, Round{Own: own, Opponent: o})
+	}
+	return append(moves, s.Move(history))
+}
+
+func TestStrategies(t *testing.T) {
+	cases := []struct {
+		strategy Strategy
+		opponent []int
+		moves    []int
+	}{
+		{TitForTat{}, []int{c, d, d, c}, []int{c, c, d, d, c}},
+		{AlwaysDefect{}, []int{c, c}, []int{d, d, d}},
+		{Grudger{}, []int{c, d, c, c}, []int{c, c, d, d, d}},
+		// same moves → cooperate, different → defect
+		{Pavlov{}, []int{c, d, d, c, d}, []int{c, c, d, c, c, d}},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.moves, play(tc.strategy, tc.opponent...), tc.strategy.Name())
+	}
+}
+
+func TestRandomMoves(t *testing.T) {
+	seen := map[int]bool{}
+	for i := 0; i < 200; i++ {
+		seen[Random{}.Move(nil)] = true
+	}
+	assert.Equal(t, map[int]bool{c: true, d: true}, seen)
+}
+
+func TestRegistry(t *testing.T) {
+	names := []string{}
+	for _, s := range All() {
+		names = append(names, s.Name())
+	}
+	assert.Equal(t, []string{"always_defect", "grudger", "pavlov", "random", "tit_for_tat"}, names)
+
+	s, ok := Get("grudger")
+	assert.True(t, ok)
+	assert.Equal(t, Grudger{}, s)
+	_, ok = Get("chess")
+	assert.False(t, ok)
+}
@@ -75,10 +75,15 @@ class LoadTester:
     async def cleanup_users(self):
         print("🧹 Cleaning up users...")
         async with aiohttp.ClientSession() as session:
-            async with session.delete(f"{BACKEND_URL}/users") as resp:
-                print(f"Cleanup status: {resp.status}")
-                if resp.status != 200:
-                    print(await resp.text())
+            for user in self.users:
+                # each test user schedules the deletion of its own account
+                async with session.delete(
+                    f"{BACKEND_URL}/me",
+                    json={"password": "securepassword123"},
+                    headers={"Authorization": f"Bearer {user['token']}"}
+                ) as resp:
+                    if resp.status != 202:
+                        print(f"Cleanup failed for {user['email']} ({resp.status}): {await resp.text()}")
 
     async def run(self):
         emails = [self.generate_email() for _ in range(NUM_USERS)]
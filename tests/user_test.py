@@ -1,20 +1,34 @@
 #!/usr/bin/env python3
-import base64
+import json
+import queue
+import threading
 import time
 import requests
 import uuid
 import random
 import string
-import os
-import jwt   # pip install PyJWT
-from dotenv import load_dotenv # pip install python-dotenv
+from http.server import BaseHTTPRequestHandler, HTTPServer
 HOST = "127.0.0.1"
 PORT = 8080
 BASE_URL = f"http://{HOST}:{PORT}"
-# Load .env into os.environ
-load_dotenv()  
-# JWT_SECRET must match the base64-encoded JWT_SECRET your Go service uses
-JWT_SECRET = os.environ.get("JWT_SECRET", "")
+# the server must run with MAIL_TRANSPORT=webhook and
+# EMAIL_WEBHOOK=http://127.0.0.1:8125, so its emails land in this sink
+MAIL_SINK_PORT = 8125
+mails = queue.Queue()
+
+class MailSink(BaseHTTPRequestHandler):
+    def do_POST(self):
+        body = self.rfile.read(int(self.headers.get("Content-Length", 0)))
+        mails.put(json.loads(body))
+        self.send_response(200)
+        self.end_headers()
+
+    def log_message(self, *args):
+        pass
+
+def start_mail_sink():
+    server = HTTPServer((HOST, MAIL_SINK_PORT), MailSink)
+    threading.Thread(target=server.serve_forever, daemon=True).start()
 
 def random_email():
     return f"{uuid.uuid4().hex[:8]}@example.com"
@@ -40,17 +54,19 @@ def forgot_password(email):
 def reset_password(token, new_password):
     return requests.post(f"{BASE_URL}/reset-password/confirm", json={"token": token, "password": new_password})
 
-def generate_reset_token(user_id, expires_in=15*60):
+def wait_for_mail(email, template, timeout=5):
     """
-    Generate a JWT reset token with typ="pwd_reset" and the same secret your server uses.
+    Return the variables of the next email with the template sent to email.
     """
-    secret = base64.b64decode(JWT_SECRET)
-    payload = {
-        "sub": user_id,
-        "exp": int(time.time()) + expires_in,
-        "typ": "pwd_reset"
-    }
-    return jwt.encode(payload, secret, algorithm="HS256")
+    deadline = time.time() + timeout
+    while time.time() < deadline:
+        try:
+            mail = mails.get(timeout=deadline - time.time())
+        except queue.Empty:
+            break
+        if mail.get("email") == email and mail.get("template") == template:
+            return mail.get("variables", {})
+    raise TimeoutError(f"no {template} email for {email}")
 
 def main():
     print("=== 1. Register with invalid data ===")
@@ -102,10 +118,10 @@ def main():
     print(r8.status_code, r8.text, "\n")
 
     print("=== 9. Reset password with correct token ===")
-    valid_token = generate_reset_token(user_id)
+    valid_token = wait_for_mail(sender_email, "reset")["TOKEN"]
     r9 = reset_password(valid_token, "NewPass123!")
     print(r9.status_code, r9.json(), "\n")
 
 if __name__ == "__main__":
-    print(f"=== JWT_SECRET === ${JWT_SECRET}")
+    start_mail_sink()
     main()
\ No newline at end of file
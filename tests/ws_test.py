@@ -110,8 +110,16 @@ class LoadTester:
 
     async def cleanup_users(self):
         async with aiohttp.ClientSession() as session:
-            async with session.delete(f"{BACKEND_URL}/users") as resp:
-                print(f"🧹 Cleanup status: {resp.status}")
+            for user in self.users:
+                # each test user schedules the deletion of its own account
+                async with session.delete(
+                    f"{BACKEND_URL}/me",
+                    json={"password": "test123456"},
+                    headers={"Authorization": f"Bearer {user['token']}"}
+                ) as resp:
+                    if resp.status != 202:
+                        print(f"🧹 Cleanup failed for {user['uuid']} ({resp.status})")
+        print(f"🧹 Scheduled deletion of {len(self.users)} users")
 
     async def run(self):
         emails = [self.generate_email() for _ in range(NUM_USERS)]